@@ -1,79 +1,198 @@
 package main
 
 import (
+	"context"
+	"crypto/rsa"
 	"fmt"
+	"go_boilerplate/internal/audit"
+	"go_boilerplate/internal/config"
 	"go_boilerplate/internal/db_utils"
-	"go_boilerplate/internal/models"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/migrations"
 	"os"
+	"strings"
 
 	"go_boilerplate/internal/routes"
 	"go_boilerplate/internal/services"
+	"go_boilerplate/pkg"
 	"net/http"
 
-	"github.com/joho/godotenv"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/rs/cors"
 )
 
 func main() {
-	err := godotenv.Load()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := config.Load()
 	if err != nil {
-		fmt.Println("Error loading .env file")
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	fmt.Println("Env loaded")
+	fmt.Println("Config loaded")
 
-	dbConfig := db_utils.NewDBConfig(db_utils.DBConfig{
-		Host:     os.Getenv("DB_HOST"),
-		Port:     os.Getenv("DB_PORT"),
-		User:     os.Getenv("DB_USER"),
-		Password: os.Getenv("DB_PW"),
-		DbName:   os.Getenv("DB_NAME"),
-		SSLMode:  "disable"})
+	dbConfig := db_utils.FromConfig(cfg.Database)
 
-	db, err := dbConfig.ConnectDB(dbConfig.GetDSNWithTimeZone("Asia/Shanghai"))
-	services.NewService(db)
-	fmt.Println("Connected to database")
+	db, err := dbConfig.ConnectDB(dbConfig.GetDSNWithTimeZone(dbConfig.TimeZone))
 	if err != nil {
 		panic("failed to connect database")
 	}
+	services.NewService(db)
 
 	fmt.Println("Connected to database")
 
-	// Migrate the schema
-	err = db.AutoMigrate(
-		&models.Brand{},
-		&models.Category{},
-		&models.Product{},
-		&models.Repair{},
-		&models.RepairStatus{},
-		&models.Order{},
-		&models.Shipping{},
-		&models.ProductPerOrder{},
-		&models.Payment{},
-		&models.ProductUpdateHistory{},
-	)
+	// Record field level changes to tracked tables
+	if err := audit.Register(db); err != nil {
+		panic("failed to register audit callbacks: " + err.Error())
+	}
+
+	// Bring the schema up to date, or refuse to run against an old one
+	migrator, err := migrations.New(db)
 	if err != nil {
-		panic("failed to migrate database")
+		panic("failed to load migrations: " + err.Error())
+	}
+	if cfg.Database.AutoMigrate {
+		if _, err := migrator.Up(); err != nil {
+			panic("failed to migrate database: " + err.Error())
+		}
+	} else {
+		pending, err := migrator.Pending()
+		if err != nil {
+			panic("failed to check migrations: " + err.Error())
+		}
+		if pending > 0 {
+			panic(fmt.Sprintf("database has %d pending migrations, run `server migrate up` or set DB_AUTO_MIGRATE=true", pending))
+		}
 	}
 	fmt.Println("Database migrated")
 
+	jwtConfig, err := loadJWTConfig(cfg.JWT)
+	if err != nil {
+		panic("failed to load JWT keys: " + err.Error())
+	}
+
+	signer, err := loadTokenSigner(cfg.JWT, jwtConfig)
+	if err != nil {
+		panic("failed to load JWT signing key: " + err.Error())
+	}
+	authService := services.NewAuthService(db, signer, cfg.JWT.RefreshTTL)
+
+	storage, err := pkg.NewStorage(cfg)
+	if err != nil {
+		panic("failed to configure storage: " + err.Error())
+	}
+
+	if cfg.Purge.Interval > 0 {
+		purger := services.NewPurgeService(db, storage, cfg.Purge.Retention)
+		go purger.Run(context.Background(), cfg.Purge.Interval)
+	}
+
+	uploadService := services.NewUploadService(db, storage, cfg.Uploads.URLTTL)
+	go uploadService.RunSweeper(context.Background(), cfg.Uploads.SweepInterval)
+
+	orderService := services.NewOrderService(db, cfg.Orders.ReservationTTL)
+	go orderService.RunReservationSweeper(context.Background(), cfg.Orders.SweepInterval)
+
 	// Initialize the router
-	router := routes.InitializeRoutes(db)
+	router := routes.InitializeRoutes(cfg, db, authService, orderService, uploadService, storage, middleware.JWTAuth(jwtConfig))
 	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"}, // Allow all origins, or specify like []string{"http://localhost:3000"}
+		AllowedOrigins:   cfg.Server.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	})
 
 	// Apply CORS middleware to the router
 	handler := corsMiddleware.Handler(router)
-	server := http.Server{Addr: ":8080", Handler: handler}
+	server := http.Server{Addr: ":" + cfg.Server.Port, Handler: handler}
 
-	fmt.Println("Starting server on port 8080")
+	fmt.Println("Starting server on port " + cfg.Server.Port)
 	fmt.Println("🔥 main() started")
 	if err := server.ListenAndServe(); err != nil {
 		panic("failed to start server")
 	}
 }
+
+// loadJWTConfig builds the token verification keys from the configuration
+func loadJWTConfig(jwtConfig config.JWTConfig) (middleware.JWTConfig, error) {
+	keys := middleware.JWTConfig{
+		HMACKeys: make(map[string][]byte),
+		RSAKeys:  make(map[string]*rsa.PublicKey),
+		Issuer:   jwtConfig.Issuer,
+		Audience: jwtConfig.Audience,
+	}
+
+	if jwtConfig.Secret != "" {
+		keys.HMACKeys[""] = []byte(jwtConfig.Secret)
+	}
+	for kid, secret := range parseKeyList(jwtConfig.HMACKeys) {
+		keys.HMACKeys[kid] = []byte(secret)
+	}
+	for kid, path := range parseKeyList(jwtConfig.RSAPublicKeys) {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return keys, err
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return keys, fmt.Errorf("key %s: %w", kid, err)
+		}
+		keys.RSAKeys[kid] = key
+	}
+	return keys, nil
+}
+
+// parseKeyList parses "kid1=value1,kid2=value2" into a map
+func parseKeyList(list string) map[string]string {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		kid, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || kid == "" {
+			continue
+		}
+		keys[kid] = value
+	}
+	return keys
+}
+
+// loadTokenSigner picks the key used to sign access tokens. SigningKID
+// selects the key; an RSA private key file switches signing to RS256,
+// otherwise the HMAC key with that kid is used.
+func loadTokenSigner(jwtConfig config.JWTConfig, keys middleware.JWTConfig) (services.TokenSigner, error) {
+	signer := services.TokenSigner{
+		KID:      jwtConfig.SigningKID,
+		Issuer:   jwtConfig.Issuer,
+		Audience: jwtConfig.Audience,
+		TTL:      jwtConfig.AccessTTL,
+	}
+
+	if jwtConfig.RSAPrivateKeyFile != "" {
+		pemBytes, err := os.ReadFile(jwtConfig.RSAPrivateKeyFile)
+		if err != nil {
+			return signer, err
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return signer, err
+		}
+		signer.Method = jwt.SigningMethodRS256
+		signer.Key = key
+		return signer, nil
+	}
+
+	secret, ok := keys.HMACKeys[jwtConfig.SigningKID]
+	if !ok {
+		return signer, fmt.Errorf("no HMAC key with kid %q", jwtConfig.SigningKID)
+	}
+	signer.Method = jwt.SigningMethodHS256
+	signer.Key = secret
+	return signer, nil
+}
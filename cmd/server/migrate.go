@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/config"
+	"go_boilerplate/internal/db_utils"
+	"go_boilerplate/internal/migrations"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up             apply all pending migrations
+  down [steps]   roll back the last applied migration, or the last <steps>
+  status         list migrations and whether they are applied
+  create <name>  add an empty up/down pair to MIGRATIONS_DIR
+                 (default internal/migrations/sql)`
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		dir := os.Getenv("MIGRATIONS_DIR")
+		if dir == "" {
+			dir = "internal/migrations/sql"
+		}
+		paths, err := migrations.Create(dir, args[1])
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "up", "down", "status":
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	cfg, err := config.LoadDatabase()
+	if err != nil {
+		return err
+	}
+	dbConfig := db_utils.FromConfig(cfg.Database)
+	db, err := dbConfig.ConnectDB(dbConfig.GetDSNWithTimeZone(dbConfig.TimeZone))
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Missing {
+				state += " (no migration file)"
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, state)
+		}
+	}
+	return nil
+}
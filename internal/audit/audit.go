@@ -0,0 +1,314 @@
+// Package audit records field level changes to tracked tables as
+// models.EntityChange rows. The changes are captured by GORM callbacks, so
+// every create, update and delete is recorded no matter which code path
+// issued it, inside the same transaction as the write itself.
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tracked lists the tables whose changes are recorded
+var Tracked = map[string]bool{
+	"products":         true,
+	"product_variants": true,
+	"product_images":   true,
+	"brands":           true,
+	"categories":       true,
+	"orders":           true,
+	"payments":         true,
+	"shippings":        true,
+	"repairs":          true,
+	"repair_images":    true,
+}
+
+// ignored columns change on every write and would only add noise
+var ignored = map[string]bool{
+	"updated_at": true,
+}
+
+// SystemActor is recorded for writes made outside an authenticated request
+const SystemActor = "system"
+
+const beforeKey = "audit:before"
+
+// Register installs the callbacks on db
+func Register(db *gorm.DB) error {
+	return errors.Join(
+		db.Callback().Create().After("gorm:create").Register("audit:after_create", afterCreate),
+		db.Callback().Update().Before("gorm:update").Register("audit:before_update", captureBefore),
+		db.Callback().Update().After("gorm:update").Register("audit:after_update", afterUpdate),
+		db.Callback().Delete().Before("gorm:delete").Register("audit:before_delete", captureBefore),
+		db.Callback().Delete().After("gorm:delete").Register("audit:after_delete", afterDelete),
+	)
+}
+
+// Actor returns the subject of the principal in ctx, or SystemActor
+func Actor(ctx context.Context) string {
+	if ctx == nil {
+		return SystemActor
+	}
+	principal, ok := middleware.PrincipalFromContext(ctx)
+	if !ok || principal.Subject == "" {
+		return SystemActor
+	}
+	return principal.Subject
+}
+
+func tracked(db *gorm.DB) bool {
+	return db.Error == nil && Tracked[db.Statement.Table]
+}
+
+// session returns a fresh statement on the same connection, so reads and
+// writes made by the callbacks join the caller's transaction. Reads are
+// unscoped so soft deleted and restored rows are seen too.
+func session(db *gorm.DB) *gorm.DB {
+	query := db.Session(&gorm.Session{NewDB: true, Context: db.Statement.Context}).Unscoped()
+	if db.Statement.Schema != nil {
+		// The model lets primary key placeholders in copied conditions resolve
+		return query.Model(reflect.New(db.Statement.Schema.ModelType).Interface())
+	}
+	return query.Table(db.Statement.Table)
+}
+
+// rows loads the current state of the rows the statement targets. It
+// returns nil when the statement has no conditions, which GORM refuses to
+// run anyway.
+func rows(db *gorm.DB) ([]map[string]interface{}, error) {
+	stmt := db.Statement
+	query := session(db)
+	conditions := false
+
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		if expression, ok := where.Expression.(clause.Where); ok && len(expression.Exprs) > 0 {
+			query = query.Clauses(clause.Where{Exprs: expression.Exprs})
+			conditions = true
+		}
+	}
+	if stmt.Schema != nil && stmt.Schema.PrioritizedPrimaryField != nil && stmt.ReflectValue.Kind() == reflect.Struct {
+		field := stmt.Schema.PrioritizedPrimaryField
+		if value, zero := field.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			query = query.Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+			conditions = true
+		}
+	}
+	if !conditions {
+		return nil, nil
+	}
+
+	var result []map[string]interface{}
+	err := query.Find(&result).Error
+	return result, err
+}
+
+// rowsByID loads the rows with the given ids
+func rowsByID(db *gorm.DB, ids []interface{}) ([]map[string]interface{}, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var result []map[string]interface{}
+	err := session(db).Where("id IN ?", ids).Find(&result).Error
+	return result, err
+}
+
+// createdIDs collects the primary keys of the rows a create inserted
+func createdIDs(db *gorm.DB) []interface{} {
+	stmt := db.Statement
+	if values, ok := stmt.Dest.(map[string]interface{}); ok {
+		if id, ok := values["id"]; ok {
+			return []interface{}{id}
+		}
+		return nil
+	}
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil
+	}
+
+	field := stmt.Schema.PrioritizedPrimaryField
+	var ids []interface{}
+	collect := func(value reflect.Value) {
+		if id, zero := field.ValueOf(stmt.Context, value); !zero {
+			ids = append(ids, id)
+		}
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct:
+		collect(stmt.ReflectValue)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			collect(reflect.Indirect(stmt.ReflectValue.Index(i)))
+		}
+	}
+	return ids
+}
+
+func captureBefore(db *gorm.DB) {
+	if !tracked(db) {
+		return
+	}
+	before, err := rows(db)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	db.InstanceSet(beforeKey, before)
+}
+
+func afterCreate(db *gorm.DB) {
+	if !tracked(db) {
+		return
+	}
+	after, err := rowsByID(db, createdIDs(db))
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	for _, row := range after {
+		record(db, models.ChangeCreate, row, diff(nil, row))
+	}
+}
+
+func afterUpdate(db *gorm.DB) {
+	if !tracked(db) {
+		return
+	}
+	value, _ := db.InstanceGet(beforeKey)
+	before, _ := value.([]map[string]interface{})
+	if len(before) == 0 {
+		return
+	}
+
+	ids := make([]interface{}, len(before))
+	for i, row := range before {
+		ids[i] = row["id"]
+	}
+	after, err := rowsByID(db, ids)
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[fmt.Sprint(row["id"])] = row
+	}
+
+	for _, old := range before {
+		current, ok := afterByID[fmt.Sprint(old["id"])]
+		if !ok {
+			continue
+		}
+		if changes := diff(old, current); len(changes) > 0 {
+			record(db, models.ChangeUpdate, current, changes)
+		}
+	}
+}
+
+func afterDelete(db *gorm.DB) {
+	if !tracked(db) || db.Statement.RowsAffected == 0 {
+		return
+	}
+	value, _ := db.InstanceGet(beforeKey)
+	before, _ := value.([]map[string]interface{})
+	for _, row := range before {
+		record(db, models.ChangeDelete, row, diff(row, nil))
+	}
+}
+
+// diff returns the columns whose values differ. A nil side stands for a
+// row that does not exist, so every column is reported.
+func diff(before, after map[string]interface{}) models.FieldChanges {
+	changes := models.FieldChanges{}
+	for column, value := range after {
+		if ignored[column] {
+			continue
+		}
+		old, existed := before[column]
+		if before == nil || !existed || !reflect.DeepEqual(old, value) {
+			changes[column] = models.FieldChange{Before: old, After: value}
+		}
+	}
+	for column, old := range before {
+		if _, exists := after[column]; !exists && !ignored[column] {
+			changes[column] = models.FieldChange{Before: old}
+		}
+	}
+	return changes
+}
+
+func record(db *gorm.DB, action string, row map[string]interface{}, changes models.FieldChanges) {
+	id, err := toUint(row["id"])
+	if err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+		return
+	}
+	change := models.EntityChange{
+		EntityType: db.Statement.Table,
+		EntityID:   id,
+		Action:     action,
+		Actor:      Actor(db.Statement.Context),
+		Changes:    changes,
+	}
+	if err := db.Session(&gorm.Session{NewDB: true, Context: db.Statement.Context}).Create(&change).Error; err != nil {
+		db.AddError(fmt.Errorf("audit: %w", err))
+	}
+}
+
+func toUint(value interface{}) (uint, error) {
+	switch id := value.(type) {
+	case int64:
+		return uint(id), nil
+	case int32:
+		return uint(id), nil
+	case int:
+		return uint(id), nil
+	case uint64:
+		return uint(id), nil
+	case uint32:
+		return uint(id), nil
+	case uint:
+		return id, nil
+	}
+	return 0, fmt.Errorf("unsupported id type %T", value)
+}
+
+// Filter narrows a change query. Zero fields match everything; times form
+// the half open range [From, To).
+type Filter struct {
+	EntityType string
+	EntityID   uint
+	Actor      string
+	From       time.Time
+	To         time.Time
+}
+
+// Changes lists the recorded changes matching filter, newest first
+func Changes(db *gorm.DB, filter Filter) ([]models.EntityChange, error) {
+	query := db.Model(&models.EntityChange{})
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	var changes []models.EntityChange
+	err := query.Order("created_at DESC, id DESC").Find(&changes).Error
+	return changes, err
+}
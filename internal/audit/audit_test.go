@@ -0,0 +1,179 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Brand{}, &models.StockMovement{}, &models.EntityChange{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func as(subject string) context.Context {
+	return middleware.WithPrincipal(context.Background(), &middleware.Principal{Subject: subject})
+}
+
+func changesOf(t *testing.T, db *gorm.DB, filter Filter) []models.EntityChange {
+	t.Helper()
+	changes, err := Changes(db, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func TestCapture(t *testing.T) {
+	db := newTestDB(t)
+	staff := db.WithContext(as("5"))
+
+	acme := models.Brand{Name: "acme"}
+	if err := staff.Create(&acme).Error; err != nil {
+		t.Fatal(err)
+	}
+	other := models.Brand{Name: "other"}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := staff.Model(&acme).Updates(map[string]interface{}{"name": "acme inc", "version": 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Writing the values a row already has changes nothing
+	if err := staff.Model(&acme).Update("name", "acme inc").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := staff.Model(&models.Brand{}).Where("id IN ?", []uint{acme.ID, other.ID}).Update("version", 3).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := staff.Delete(&models.Brand{}, other.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Untracked tables are not recorded
+	if err := staff.Create(&models.StockMovement{ProductID: 1, Kind: models.MovementReceipt, Quantity: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Values are read back from JSON, so numbers are float64
+	changes := changesOf(t, db, Filter{})
+	tests := []struct {
+		action   string
+		entityID uint
+		actor    string
+		column   string
+		before   interface{}
+		after    interface{}
+	}{
+		// Newest first
+		{models.ChangeDelete, other.ID, "5", "name", "other", nil},
+		{models.ChangeUpdate, other.ID, "5", "version", float64(1), float64(3)},
+		{models.ChangeUpdate, acme.ID, "5", "version", float64(2), float64(3)},
+		{models.ChangeUpdate, acme.ID, "5", "name", "acme", "acme inc"},
+		{models.ChangeCreate, other.ID, SystemActor, "name", nil, "other"},
+		{models.ChangeCreate, acme.ID, "5", "name", nil, "acme"},
+	}
+	if len(changes) != len(tests) {
+		t.Fatalf("recorded %d changes, want %d: %+v", len(changes), len(tests), changes)
+	}
+	for i, tt := range tests {
+		change := changes[i]
+		if change.EntityType != "brands" || change.Action != tt.action || change.EntityID != tt.entityID || change.Actor != tt.actor {
+			t.Errorf("change %d = %s %s %d by %s, want %s brands %d by %s", i, change.Action, change.EntityType, change.EntityID, change.Actor, tt.action, tt.entityID, tt.actor)
+			continue
+		}
+		field, ok := change.Changes[tt.column]
+		if !ok || field.Before != tt.before || field.After != tt.after {
+			t.Errorf("change %d: %s = %+v, want %v to %v", i, tt.column, field, tt.before, tt.after)
+		}
+		if _, ok := change.Changes["updated_at"]; ok {
+			t.Errorf("change %d records updated_at", i)
+		}
+	}
+	if update := changes[3].Changes; len(update) != 2 {
+		t.Errorf("update recorded %v, want only name and version", update)
+	}
+}
+
+func TestCaptureRollsBackWithTheWrite(t *testing.T) {
+	db := newTestDB(t)
+	failed := errors.New("failed")
+	err := db.WithContext(as("5")).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.Brand{Name: "acme"}).Error; err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatal(err)
+	}
+	if changes := changesOf(t, db, Filter{}); len(changes) != 0 {
+		t.Errorf("recorded %+v for a rolled back write", changes)
+	}
+}
+
+func TestChangesFilter(t *testing.T) {
+	db := newTestDB(t)
+	for _, write := range []struct {
+		actor, name string
+	}{{"5", "acme"}, {"6", "other"}, {"5", "third"}} {
+		if err := db.WithContext(as(write.actor)).Create(&models.Brand{Name: write.name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"everything", Filter{}, 3},
+		{"by entity type", Filter{EntityType: "brands"}, 3},
+		{"by other entity type", Filter{EntityType: "products"}, 0},
+		{"by entity", Filter{EntityType: "brands", EntityID: 2}, 1},
+		{"by actor", Filter{Actor: "5"}, 2},
+		{"from an hour ago", Filter{From: now.Add(-time.Hour)}, 3},
+		{"before an hour ago", Filter{To: now.Add(-time.Hour)}, 0},
+		{"in the next hour", Filter{From: now.Add(time.Second), To: now.Add(time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		if changes := changesOf(t, db, tt.filter); len(changes) != tt.want {
+			t.Errorf("%s: %d changes, want %d", tt.name, len(changes), tt.want)
+		}
+	}
+}
+
+func TestActor(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"authenticated", as("42"), "42"},
+		{"empty subject", as(""), SystemActor},
+		{"no principal", context.Background(), SystemActor},
+		{"no context", nil, SystemActor},
+	}
+	for _, tt := range tests {
+		if got := Actor(tt.ctx); got != tt.want {
+			t.Errorf("%s: Actor = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the application configuration. Values are resolved in this
+// order, later sources overriding earlier ones:
+//
+//  1. defaults from Default
+//  2. the YAML or TOML file named by CONFIG_FILE, if set
+//  3. variables from a .env file in the working directory
+//  4. the process environment
+//
+// Each field's env tag names the variable that overrides it.
+type Config struct {
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	JWT      JWTConfig      `yaml:"jwt" toml:"jwt"`
+	Storage  StorageConfig  `yaml:"storage" toml:"storage"`
+	Images   ImagesConfig   `yaml:"images" toml:"images"`
+	S3       S3Config       `yaml:"s3" toml:"s3"`
+	Purge    PurgeConfig    `yaml:"purge" toml:"purge"`
+	Orders   OrdersConfig   `yaml:"orders" toml:"orders"`
+	Uploads  UploadsConfig  `yaml:"uploads" toml:"uploads"`
+}
+
+type ServerConfig struct {
+	Port           string   `yaml:"port" toml:"port" env:"PORT"`
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST"`
+	Port     string `yaml:"port" toml:"port" env:"DB_PORT"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER"`
+	Password string `yaml:"password" toml:"password" env:"DB_PW"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"ssl_mode" toml:"ssl_mode" env:"DB_SSL_MODE"`
+	TimeZone string `yaml:"time_zone" toml:"time_zone" env:"DB_TIME_ZONE"`
+	// AutoMigrate applies pending migrations when the server starts instead
+	// of refusing to start
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+// JWTConfig holds token keys. HMACKeys and RSAPublicKeys are comma separated
+// kid=value lists, where RSA values are paths to PEM encoded public keys.
+// Secret is a shorthand for a single HMAC key without a kid.
+type JWTConfig struct {
+	Secret            string        `yaml:"secret" toml:"secret" env:"JWT_SECRET"`
+	HMACKeys          string        `yaml:"hmac_keys" toml:"hmac_keys" env:"JWT_HMAC_KEYS"`
+	RSAPublicKeys     string        `yaml:"rsa_public_keys" toml:"rsa_public_keys" env:"JWT_RSA_PUBLIC_KEYS"`
+	RSAPrivateKeyFile string        `yaml:"rsa_private_key_file" toml:"rsa_private_key_file" env:"JWT_RSA_PRIVATE_KEY_FILE"`
+	SigningKID        string        `yaml:"signing_kid" toml:"signing_kid" env:"JWT_SIGNING_KID"`
+	Issuer            string        `yaml:"issuer" toml:"issuer" env:"JWT_ISSUER"`
+	Audience          string        `yaml:"audience" toml:"audience" env:"JWT_AUDIENCE"`
+	AccessTTL         time.Duration `yaml:"access_ttl" toml:"access_ttl" env:"JWT_ACCESS_TTL"`
+	RefreshTTL        time.Duration `yaml:"refresh_ttl" toml:"refresh_ttl" env:"JWT_REFRESH_TTL"`
+}
+
+// StorageConfig selects where uploads are kept: "local" stores them under
+// LocalRoot and serves them from PublicURL, "s3" uses the S3 settings.
+type StorageConfig struct {
+	Backend   string `yaml:"backend" toml:"backend" env:"STORAGE_BACKEND"`
+	LocalRoot string `yaml:"local_root" toml:"local_root" env:"STORAGE_LOCAL_ROOT"`
+	PublicURL string `yaml:"public_url" toml:"public_url" env:"STORAGE_PUBLIC_URL"`
+}
+
+// ImagesConfig limits image uploads and sets the widths of the WebP
+// renditions made from each one. Uploads larger than MaxBytes or than
+// MaxWidth by MaxHeight pixels are rejected.
+type ImagesConfig struct {
+	MaxBytes       int `yaml:"max_bytes" toml:"max_bytes" env:"IMAGE_MAX_BYTES"`
+	MaxWidth       int `yaml:"max_width" toml:"max_width" env:"IMAGE_MAX_WIDTH"`
+	MaxHeight      int `yaml:"max_height" toml:"max_height" env:"IMAGE_MAX_HEIGHT"`
+	ThumbnailWidth int `yaml:"thumbnail_width" toml:"thumbnail_width" env:"IMAGE_THUMBNAIL_WIDTH"`
+	MediumWidth    int `yaml:"medium_width" toml:"medium_width" env:"IMAGE_MEDIUM_WIDTH"`
+	LargeWidth     int `yaml:"large_width" toml:"large_width" env:"IMAGE_LARGE_WIDTH"`
+}
+
+// S3Config describes the bucket and how to authenticate against it.
+// Credentials selects the provider: "static" uses the access key fields,
+// "env" reads AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY, "shared" reads the
+// shared credentials file, and "" uses the SDK's default chain. Endpoint and
+// ForcePathStyle allow pointing at S3 compatible stores such as MinIO.
+type S3Config struct {
+	Region                string `yaml:"region" toml:"region" env:"S3_REGION"`
+	BucketName            string `yaml:"bucket" toml:"bucket" env:"S3_BUCKET"`
+	Endpoint              string `yaml:"endpoint" toml:"endpoint" env:"S3_ENDPOINT"`
+	ForcePathStyle        bool   `yaml:"force_path_style" toml:"force_path_style" env:"S3_FORCE_PATH_STYLE"`
+	Credentials           string `yaml:"credentials" toml:"credentials" env:"S3_CREDENTIALS"`
+	AccessKeyID           string `yaml:"access_key_id" toml:"access_key_id" env:"S3_ACCESS_KEY_ID"`
+	SecretAccessKey       string `yaml:"secret_access_key" toml:"secret_access_key" env:"S3_SECRET_ACCESS_KEY"`
+	SharedCredentialsFile string `yaml:"shared_credentials_file" toml:"shared_credentials_file" env:"S3_SHARED_CREDENTIALS_FILE"`
+	Profile               string `yaml:"profile" toml:"profile" env:"S3_PROFILE"`
+}
+
+// PurgeConfig controls the job that permanently removes soft deleted rows.
+// Rows deleted longer than Retention ago are purged every Interval; an
+// Interval of zero disables the job.
+type PurgeConfig struct {
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"PURGE_RETENTION"`
+	Interval  time.Duration `yaml:"interval" toml:"interval" env:"PURGE_INTERVAL"`
+}
+
+// OrdersConfig controls stock reservations. Stock held for an unpaid order
+// is released after ReservationTTL; expired reservations are looked for
+// every SweepInterval.
+type OrdersConfig struct {
+	ReservationTTL time.Duration `yaml:"reservation_ttl" toml:"reservation_ttl" env:"ORDER_RESERVATION_TTL"`
+	SweepInterval  time.Duration `yaml:"sweep_interval" toml:"sweep_interval" env:"ORDER_SWEEP_INTERVAL"`
+}
+
+// UploadsConfig controls direct uploads. A presigned upload URL is valid
+// for URLTTL and the upload must be completed within twice that; uploads
+// that never were are swept every SweepInterval.
+type UploadsConfig struct {
+	URLTTL        time.Duration `yaml:"url_ttl" toml:"url_ttl" env:"UPLOAD_URL_TTL"`
+	SweepInterval time.Duration `yaml:"sweep_interval" toml:"sweep_interval" env:"UPLOAD_SWEEP_INTERVAL"`
+}
+
+// Default returns the configuration used when nothing overrides a value
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:           "8080",
+			AllowedOrigins: []string{"*"},
+		},
+		Database: DatabaseConfig{
+			Port:     "5432",
+			SSLMode:  "disable",
+			TimeZone: "Asia/Shanghai",
+		},
+		JWT: JWTConfig{
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 30 * 24 * time.Hour,
+		},
+		Storage: StorageConfig{
+			Backend:   "local",
+			LocalRoot: "uploads",
+			PublicURL: "/uploads",
+		},
+		Images: ImagesConfig{
+			MaxBytes:       10 << 20,
+			MaxWidth:       6000,
+			MaxHeight:      6000,
+			ThumbnailWidth: 160,
+			MediumWidth:    640,
+			LargeWidth:     1280,
+		},
+		S3: S3Config{
+			Region: "ap-southeast-1",
+		},
+		Purge: PurgeConfig{
+			Retention: 30 * 24 * time.Hour,
+			Interval:  24 * time.Hour,
+		},
+		Orders: OrdersConfig{
+			ReservationTTL: 30 * time.Minute,
+			SweepInterval:  time.Minute,
+		},
+		Uploads: UploadsConfig{
+			URLTTL:        15 * time.Minute,
+			SweepInterval: 10 * time.Minute,
+		},
+	}
+}
+
+// Load resolves the configuration from all sources and validates it
+func Load() (*Config, error) {
+	config, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadDatabase resolves the configuration but only validates the database
+// settings, for tools such as the migrate command that never serve requests
+func LoadDatabase() (*Config, error) {
+	config, err := load()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	config.validateDatabase(&errs)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return config, nil
+}
+
+func load() (*Config, error) {
+	config := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, &config); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	// godotenv never overrides variables that are already set, which gives
+	// the process environment precedence over .env
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf(".env: %w", err)
+	}
+
+	if err := applyEnv(reflect.ValueOf(&config).Elem()); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// loadFile decodes a YAML or TOML file, chosen by extension, into config
+func loadFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(data, config)
+	case ".toml":
+		return toml.Unmarshal(data, config)
+	}
+	return fmt.Errorf("unsupported extension %q, use .yaml, .yml or .toml", filepath.Ext(path))
+}
+
+// applyEnv overrides fields that have an env tag with the variable's value
+func applyEnv(value reflect.Value) error {
+	var errs []error
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		fieldType := value.Type().Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		name := fieldType.Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setField(field reflect.Value, raw string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(raw)
+	case time.Duration:
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+	case int:
+		number, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(number))
+	case bool:
+		flag, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(flag)
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
+
+func (config *Config) validateDatabase(errs *[]error) {
+	required := []struct{ name, value string }{
+		{"DB_HOST", config.Database.Host},
+		{"DB_PORT", config.Database.Port},
+		{"DB_USER", config.Database.User},
+		{"DB_NAME", config.Database.Name},
+	}
+	for _, field := range required {
+		if strings.TrimSpace(field.value) == "" {
+			*errs = append(*errs, fmt.Errorf("%s is required", field.name))
+		}
+	}
+	switch config.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		*errs = append(*errs, fmt.Errorf("DB_SSL_MODE %q is not a valid sslmode", config.Database.SSLMode))
+	}
+	if _, err := time.LoadLocation(config.Database.TimeZone); err != nil {
+		*errs = append(*errs, fmt.Errorf("DB_TIME_ZONE: %w", err))
+	}
+}
+
+// Validate reports every missing or invalid setting at once
+func (config *Config) Validate() error {
+	var errs []error
+	require := func(value, name string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+
+	require(config.Server.Port, "PORT")
+
+	config.validateDatabase(&errs)
+
+	if config.JWT.Secret == "" && config.JWT.HMACKeys == "" && config.JWT.RSAPublicKeys == "" {
+		errs = append(errs, errors.New("one of JWT_SECRET, JWT_HMAC_KEYS or JWT_RSA_PUBLIC_KEYS is required"))
+	}
+	if config.JWT.AccessTTL <= 0 {
+		errs = append(errs, errors.New("JWT_ACCESS_TTL must be positive"))
+	}
+	if config.JWT.RefreshTTL <= 0 {
+		errs = append(errs, errors.New("JWT_REFRESH_TTL must be positive"))
+	}
+
+	if config.Purge.Retention <= 0 {
+		errs = append(errs, errors.New("PURGE_RETENTION must be positive"))
+	}
+	if config.Purge.Interval < 0 {
+		errs = append(errs, errors.New("PURGE_INTERVAL must not be negative"))
+	}
+
+	if config.Orders.ReservationTTL <= 0 {
+		errs = append(errs, errors.New("ORDER_RESERVATION_TTL must be positive"))
+	}
+	if config.Orders.SweepInterval <= 0 {
+		errs = append(errs, errors.New("ORDER_SWEEP_INTERVAL must be positive"))
+	}
+
+	if config.Uploads.URLTTL <= 0 {
+		errs = append(errs, errors.New("UPLOAD_URL_TTL must be positive"))
+	}
+	if config.Uploads.SweepInterval <= 0 {
+		errs = append(errs, errors.New("UPLOAD_SWEEP_INTERVAL must be positive"))
+	}
+
+	positive := []struct {
+		name  string
+		value int
+	}{
+		{"IMAGE_MAX_BYTES", config.Images.MaxBytes},
+		{"IMAGE_MAX_WIDTH", config.Images.MaxWidth},
+		{"IMAGE_MAX_HEIGHT", config.Images.MaxHeight},
+		{"IMAGE_THUMBNAIL_WIDTH", config.Images.ThumbnailWidth},
+		{"IMAGE_MEDIUM_WIDTH", config.Images.MediumWidth},
+		{"IMAGE_LARGE_WIDTH", config.Images.LargeWidth},
+	}
+	for _, field := range positive {
+		if field.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", field.name))
+		}
+	}
+
+	switch config.Storage.Backend {
+	case "local":
+		require(config.Storage.LocalRoot, "STORAGE_LOCAL_ROOT")
+		require(config.Storage.PublicURL, "STORAGE_PUBLIC_URL")
+	case "s3":
+		require(config.S3.Region, "S3_REGION")
+		require(config.S3.BucketName, "S3_BUCKET")
+		switch config.S3.Credentials {
+		case "static":
+			require(config.S3.AccessKeyID, "S3_ACCESS_KEY_ID")
+			require(config.S3.SecretAccessKey, "S3_SECRET_ACCESS_KEY")
+		case "", "env", "shared":
+		default:
+			errs = append(errs, fmt.Errorf("S3_CREDENTIALS %q must be one of static, env or shared", config.S3.Credentials))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_BACKEND %q must be local or s3", config.Storage.Backend))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inDir runs the test in dir, where load looks for .env
+func inDir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// unsetEnv clears the variables for the test and restores them afterwards,
+// including any that .env sets while loading
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const yamlFile = `
+server:
+  port: "1000"
+database:
+  host: file-host
+  name: file-name
+  user: file-user
+`
+	const tomlFile = `
+[server]
+port = "1000"
+
+[database]
+host = "file-host"
+name = "file-name"
+user = "file-user"
+`
+	const dotEnv = "PORT=2000\nDB_HOST=dotenv-host\n"
+
+	tests := []struct {
+		name             string
+		file, ext        string
+		dotEnv           string
+		env              map[string]string
+		port, host, user string
+		dbName           string
+	}{
+		{"defaults", "", "", "", nil, "8080", "", "", ""},
+		{"yaml file", yamlFile, ".yaml", "", nil, "1000", "file-host", "file-user", "file-name"},
+		{"toml file", tomlFile, ".toml", "", nil, "1000", "file-host", "file-user", "file-name"},
+		{".env over the file", yamlFile, ".yml", dotEnv, nil, "2000", "dotenv-host", "file-user", "file-name"},
+		{"environment over .env and the file", yamlFile, ".yaml", dotEnv, map[string]string{"PORT": "3000", "DB_USER": "env-user"}, "3000", "dotenv-host", "env-user", "file-name"},
+		{".env without a file", "", "", dotEnv, nil, "2000", "dotenv-host", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inDir(t, dir)
+			unsetEnv(t, "CONFIG_FILE", "PORT", "DB_HOST", "DB_USER", "DB_NAME")
+			if tt.file != "" {
+				t.Setenv("CONFIG_FILE", writeFile(t, dir, "config"+tt.ext, tt.file))
+			}
+			if tt.dotEnv != "" {
+				writeFile(t, dir, ".env", tt.dotEnv)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			config, err := load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{config.Server.Port, config.Database.Host, config.Database.User, config.Database.Name}
+			want := []string{tt.port, tt.host, tt.user, tt.dbName}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("port, host, user, name = %q, want %q", got, want)
+			}
+			// Values no source sets keep their defaults
+			if config.Database.SSLMode != "disable" || config.Orders.ReservationTTL != 30*time.Minute {
+				t.Errorf("defaults were lost: %+v", config.Database)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	inDir(t, dir)
+	unsetEnv(t, "CONFIG_FILE")
+
+	t.Setenv("CONFIG_FILE", writeFile(t, dir, "config.json", "{}"))
+	if _, err := load(); err == nil || !strings.Contains(err.Error(), "unsupported extension") {
+		t.Errorf("JSON config file error = %v, want an unsupported extension", err)
+	}
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "missing.yaml"))
+	if _, err := load(); err == nil {
+		t.Error("a missing config file was accepted")
+	}
+
+	unsetEnv(t, "CONFIG_FILE")
+	t.Setenv("ORDER_RESERVATION_TTL", "soon")
+	t.Setenv("IMAGE_MAX_WIDTH", "wide")
+	_, err := load()
+	if err == nil || !strings.Contains(err.Error(), "ORDER_RESERVATION_TTL") || !strings.Contains(err.Error(), "IMAGE_MAX_WIDTH") {
+		t.Errorf("error = %v, want both bad variables reported", err)
+	}
+}
+
+func TestApplyEnvTypes(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example, ,https://b.example ")
+	t.Setenv("DB_AUTO_MIGRATE", "true")
+	t.Setenv("PURGE_RETENTION", "48h")
+	t.Setenv("IMAGE_MAX_BYTES", "1024")
+
+	config := Default()
+	if err := applyEnv(reflect.ValueOf(&config).Elem()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://a.example", "https://b.example"}; !reflect.DeepEqual(config.Server.AllowedOrigins, want) {
+		t.Errorf("AllowedOrigins = %q, want %q", config.Server.AllowedOrigins, want)
+	}
+	if !config.Database.AutoMigrate || config.Purge.Retention != 48*time.Hour || config.Images.MaxBytes != 1024 {
+		t.Errorf("AutoMigrate, Retention, MaxBytes = %v, %s, %d", config.Database.AutoMigrate, config.Purge.Retention, config.Images.MaxBytes)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Default()
+	valid.Database.Host, valid.Database.User, valid.Database.Name = "localhost", "app", "shop"
+	valid.JWT.Secret = "secret"
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid configuration: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"missing database settings", func(c *Config) { c.Database.Host, c.Database.Name = "", " " }, []string{"DB_HOST is required", "DB_NAME is required"}},
+		{"bad sslmode and time zone", func(c *Config) { c.Database.SSLMode, c.Database.TimeZone = "maybe", "Mars/Base" }, []string{"DB_SSL_MODE", "DB_TIME_ZONE"}},
+		{"no JWT key", func(c *Config) { c.JWT.Secret = "" }, []string{"one of JWT_SECRET"}},
+		{"non-positive durations", func(c *Config) { c.JWT.AccessTTL, c.Orders.SweepInterval = 0, -time.Second }, []string{"JWT_ACCESS_TTL", "ORDER_SWEEP_INTERVAL"}},
+		{"unknown storage backend", func(c *Config) { c.Storage.Backend = "ftp" }, []string{"STORAGE_BACKEND"}},
+		{"s3 without a bucket or static keys", func(c *Config) {
+			c.Storage.Backend, c.S3.Credentials = "s3", "static"
+		}, []string{"S3_BUCKET", "S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY"}},
+	}
+	for _, tt := range tests {
+		config := valid
+		tt.modify(&config)
+		err := config.Validate()
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		// Every problem is reported at once
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %s", tt.name, err, want)
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package db_utils
 
 import (
+	"go_boilerplate/internal/config"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -12,6 +14,7 @@ type DBConfig struct {
 	Password string
 	DbName   string
 	SSLMode  string
+	TimeZone string
 }
 
 func NewDBConfig(config DBConfig) *DBConfig {
@@ -22,9 +25,23 @@ func NewDBConfig(config DBConfig) *DBConfig {
 		Password: config.Password,
 		DbName:   config.DbName,
 		SSLMode:  config.SSLMode,
+		TimeZone: config.TimeZone,
 	}
 }
 
+// FromConfig builds the connection settings from the application configuration
+func FromConfig(database config.DatabaseConfig) *DBConfig {
+	return NewDBConfig(DBConfig{
+		Host:     database.Host,
+		Port:     database.Port,
+		User:     database.User,
+		Password: database.Password,
+		DbName:   database.Name,
+		SSLMode:  database.SSLMode,
+		TimeZone: database.TimeZone,
+	})
+}
+
 func (dbConfig *DBConfig) GetDSN() string {
 	return "host=" + dbConfig.Host +
 		" port=" + dbConfig.Port +
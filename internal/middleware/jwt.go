@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig holds the keys and expectations used to validate bearer tokens.
+// Keys are looked up by the token's "kid" header so old and new keys can be
+// accepted side by side while a key is being rotated.
+type JWTConfig struct {
+	HMACKeys map[string][]byte
+	RSAKeys  map[string]*rsa.PublicKey
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Claims are the JWT claims understood by the API
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Principal is the authenticated caller attached to the request context
+type Principal struct {
+	Subject string
+	Roles   []string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored by JWTAuth, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// JWTAuth returns a middleware that requires a valid HS256 or RS256 bearer
+// token and stores the token's subject and roles in the request context
+func JWTAuth(config JWTConfig) MiddlewareFunc {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(config.Leeway),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+	parser := jwt.NewParser(options...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			tokenString, found := strings.CutPrefix(header, "Bearer ")
+			if !found || tokenString == "" {
+				unauthorized(w, "Missing bearer token")
+				return
+			}
+
+			var claims Claims
+			_, err := parser.ParseWithClaims(tokenString, &claims, config.keyFunc)
+			if err != nil {
+				if errors.Is(err, jwt.ErrTokenExpired) {
+					unauthorized(w, "Token has expired")
+					return
+				}
+				unauthorized(w, "Invalid token")
+				return
+			}
+			if claims.Subject == "" {
+				unauthorized(w, "Token has no subject")
+				return
+			}
+
+			principal := &Principal{Subject: claims.Subject, Roles: claims.Roles}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// Optional runs auth only when the request carries an Authorization header,
+// so public routes can still recognise signed in callers. A header with a
+// bad token is rejected as usual.
+func Optional(auth MiddlewareFunc) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		authed := auth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			authed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// keyFunc picks the verification key matching the token's algorithm and kid.
+// Tokens without a kid use the key registered under "" or, failing that,
+// the only key of that type.
+func (config JWTConfig) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return lookupKey(config.HMACKeys, kid)
+	case jwt.SigningMethodRS256.Alg():
+		return lookupKey(config.RSAKeys, kid)
+	}
+	return nil, errors.New("unsupported signing method")
+}
+
+func lookupKey[K []byte | *rsa.PublicKey](keys map[string]K, kid string) (interface{}, error) {
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, errors.New("unknown kid")
+}
+
+// unauthorized writes a JSON 401 response with a bearer challenge
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	writeError(w, http.StatusUnauthorized, message)
+}
+
+// writeError writes the API's standard JSON error body
+func writeError(w http.ResponseWriter, status int, message string) {
+	response := map[string]interface{}{
+		"message": message,
+		"status":  "error",
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
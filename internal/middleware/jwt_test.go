@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// whoami answers with the principal JWTAuth stored, or 204 without one
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Write([]byte(principal.Subject + ":" + strings.Join(principal.Roles, ",")))
+})
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSecret, newSecret := []byte("old-secret"), []byte("new-secret")
+	// Both HMAC keys are accepted while tokens move from "2025" to "2026"
+	config := JWTConfig{
+		HMACKeys: map[string][]byte{"2025": oldSecret, "2026": newSecret},
+		RSAKeys:  map[string]*rsa.PublicKey{"rsa-1": &rsaKey.PublicKey},
+		Issuer:   "api",
+		Audience: "shop",
+	}
+	auth := JWTAuth(config)(whoami)
+
+	claims := func(modify func(*Claims)) Claims {
+		c := Claims{
+			Roles: []string{RoleStaff},
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   "42",
+				Issuer:    "api",
+				Audience:  jwt.ClaimStrings{"shop"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+		if modify != nil {
+			modify(&c)
+		}
+		return c
+	}
+	valid := claims(nil)
+
+	tests := []struct {
+		name    string
+		header  string
+		status  int
+		body    string
+		message string
+	}{
+		{"old HMAC kid", "Bearer " + signToken(t, jwt.SigningMethodHS256, oldSecret, "2025", valid), http.StatusOK, "42:staff", ""},
+		{"new HMAC kid", "Bearer " + signToken(t, jwt.SigningMethodHS256, newSecret, "2026", valid), http.StatusOK, "42:staff", ""},
+		{"RSA kid", "Bearer " + signToken(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", valid), http.StatusOK, "42:staff", ""},
+		{"retired kid", "Bearer " + signToken(t, jwt.SigningMethodHS256, oldSecret, "2024", valid), http.StatusUnauthorized, "", "Invalid token"},
+		{"key of another kid", "Bearer " + signToken(t, jwt.SigningMethodHS256, oldSecret, "2026", valid), http.StatusUnauthorized, "", "Invalid token"},
+		{"no kid with several keys", "Bearer " + signToken(t, jwt.SigningMethodHS256, oldSecret, "", valid), http.StatusUnauthorized, "", "Invalid token"},
+		{"no kid with one RSA key", "Bearer " + signToken(t, jwt.SigningMethodRS256, rsaKey, "", valid), http.StatusOK, "42:staff", ""},
+		{"unaccepted algorithm", "Bearer " + signToken(t, jwt.SigningMethodHS384, oldSecret, "2025", valid), http.StatusUnauthorized, "", "Invalid token"},
+		{"unsigned", "Bearer " + signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "2025", valid), http.StatusUnauthorized, "", "Invalid token"},
+		{"expired", "Bearer " + signToken(t, jwt.SigningMethodHS256, newSecret, "2026", claims(func(c *Claims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		})), http.StatusUnauthorized, "", "Token has expired"},
+		{"no expiry", "Bearer " + signToken(t, jwt.SigningMethodHS256, newSecret, "2026", claims(func(c *Claims) {
+			c.ExpiresAt = nil
+		})), http.StatusUnauthorized, "", "Invalid token"},
+		{"other issuer", "Bearer " + signToken(t, jwt.SigningMethodHS256, newSecret, "2026", claims(func(c *Claims) {
+			c.Issuer = "elsewhere"
+		})), http.StatusUnauthorized, "", "Invalid token"},
+		{"other audience", "Bearer " + signToken(t, jwt.SigningMethodHS256, newSecret, "2026", claims(func(c *Claims) {
+			c.Audience = jwt.ClaimStrings{"admin"}
+		})), http.StatusUnauthorized, "", "Invalid token"},
+		{"no subject", "Bearer " + signToken(t, jwt.SigningMethodHS256, newSecret, "2026", claims(func(c *Claims) {
+			c.Subject = ""
+		})), http.StatusUnauthorized, "", "Token has no subject"},
+		{"no header", "", http.StatusUnauthorized, "", "Missing bearer token"},
+		{"other scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "", "Missing bearer token"},
+		{"garbage", "Bearer not.a.token", http.StatusUnauthorized, "", "Invalid token"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		auth.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+			continue
+		}
+		if tt.status == http.StatusOK {
+			if body := rec.Body.String(); body != tt.body {
+				t.Errorf("%s: principal = %q, want %q", tt.name, body, tt.body)
+			}
+			continue
+		}
+		var response struct{ Message, Status string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || response.Message != tt.message || response.Status != "error" {
+			t.Errorf("%s: body = %s, want the JSON error %q", tt.name, rec.Body, tt.message)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate challenge", tt.name)
+		}
+	}
+}
+
+func TestOptional(t *testing.T) {
+	config := JWTConfig{HMACKeys: map[string][]byte{"": []byte("secret")}}
+	handler := Optional(JWTAuth(config))(whoami)
+	token := signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", Claims{
+		Roles:            []string{RoleCustomer},
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "7", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+
+	tests := []struct {
+		name, header string
+		status       int
+	}{
+		{"anonymous", "", http.StatusNoContent},
+		{"signed in", "Bearer " + token, http.StatusOK},
+		{"bad token", "Bearer " + token + "x", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
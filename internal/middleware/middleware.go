@@ -2,20 +2,25 @@ package middleware
 
 import "net/http"
 
-type Middleware struct{
+type Middleware struct {
 	handler http.Handler
 }
 
 type MiddlewareFunc func(http.Handler) http.Handler
+
 func SetHandler(handler http.Handler) *Middleware {
 	return &Middleware{
 		handler: handler,
 	}
 }
 
+// Chain wraps the handler with the given middlewares and returns the result.
+// The first middleware is the outermost one, so it runs first on every request.
+// The wrapped handler is left untouched, so Chain can be called more than once.
 func (mw *Middleware) Chain(middlewares ...MiddlewareFunc) http.Handler {
-	for _,middleware:=range middlewares{
-		mw.handler = middleware(mw.handler)
+	handler := mw.handler
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
 	}
-	return mw.handler
-}
\ No newline at end of file
+	return handler
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Roles carried in the token's "roles" claim
+const (
+	RoleAdmin      = "admin"
+	RoleStaff      = "staff"
+	RoleTechnician = "technician"
+	RoleCustomer   = "customer"
+)
+
+// Permission names a capability that routes can require
+type Permission string
+
+const (
+	PermManageCatalog  Permission = "catalog:manage"
+	PermManageHistory  Permission = "history:manage"
+	PermManageOrders   Permission = "orders:manage"
+	PermPlaceOrders    Permission = "orders:place"
+	PermManageRepairs  Permission = "repairs:manage"
+	PermRequestRepairs Permission = "repairs:request"
+	PermManageUsers    Permission = "users:manage"
+)
+
+// rolePermissions maps each role to the permissions it grants.
+// Unknown roles grant nothing.
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermManageCatalog,
+		PermManageHistory,
+		PermManageOrders,
+		PermManageRepairs,
+		PermManageUsers,
+	},
+	RoleStaff: {
+		PermManageCatalog,
+		PermManageOrders,
+		PermManageRepairs,
+	},
+	RoleTechnician: {
+		PermManageRepairs,
+	},
+	RoleCustomer: {
+		PermPlaceOrders,
+		PermRequestRepairs,
+	},
+}
+
+// HasRole reports whether the principal was issued the given role
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && slices.Contains(p.Roles, role)
+}
+
+// Can reports whether any of the principal's roles grants the permission
+func (p *Principal) Can(permission Permission) bool {
+	if p == nil {
+		return false
+	}
+	for _, role := range p.Roles {
+		if slices.Contains(rolePermissions[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission returns a middleware that lets the request through when
+// the authenticated principal holds at least one of the given permissions.
+// It must run after JWTAuth.
+func RequirePermission(permissions ...Permission) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				unauthorized(w, "Authentication required")
+				return
+			}
+			for _, permission := range permissions {
+				if principal.Can(permission) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeError(w, http.StatusForbidden, "Insufficient permissions")
+		})
+	}
+}
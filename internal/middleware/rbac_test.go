@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrincipalCan(t *testing.T) {
+	tests := []struct {
+		roles      []string
+		permission Permission
+		want       bool
+	}{
+		{[]string{RoleAdmin}, PermManageUsers, true},
+		{[]string{RoleAdmin}, PermManageHistory, true},
+		{[]string{RoleStaff}, PermManageCatalog, true},
+		{[]string{RoleStaff}, PermManageUsers, false},
+		{[]string{RoleStaff}, PermManageHistory, false},
+		{[]string{RoleTechnician}, PermManageRepairs, true},
+		{[]string{RoleTechnician}, PermManageOrders, false},
+		{[]string{RoleCustomer}, PermPlaceOrders, true},
+		{[]string{RoleCustomer}, PermRequestRepairs, true},
+		{[]string{RoleCustomer}, PermManageOrders, false},
+		{[]string{RoleCustomer, RoleTechnician}, PermManageRepairs, true},
+		{[]string{"owner"}, PermManageCatalog, false},
+		{nil, PermPlaceOrders, false},
+	}
+	for _, tt := range tests {
+		principal := &Principal{Subject: "1", Roles: tt.roles}
+		if got := principal.Can(tt.permission); got != tt.want {
+			t.Errorf("%v.Can(%s) = %v, want %v", tt.roles, tt.permission, got, tt.want)
+		}
+	}
+
+	var anonymous *Principal
+	if anonymous.Can(PermPlaceOrders) || anonymous.HasRole(RoleCustomer) {
+		t.Error("a nil principal must hold no permission or role")
+	}
+	if staff := (&Principal{Roles: []string{RoleStaff}}); !staff.HasRole(RoleStaff) || staff.HasRole(RoleAdmin) {
+		t.Error("HasRole must only report the principal's own roles")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	handler := RequirePermission(PermManageRepairs, PermRequestRepairs)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		status    int
+	}{
+		{"technician", &Principal{Subject: "1", Roles: []string{RoleTechnician}}, http.StatusOK},
+		{"customer through the second permission", &Principal{Subject: "2", Roles: []string{RoleCustomer}}, http.StatusOK},
+		{"role without either permission", &Principal{Subject: "3", Roles: []string{"guest"}}, http.StatusForbidden},
+		{"no principal", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.principal != nil {
+			req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// lockKey identifies the Postgres advisory lock held while migrating, so two
+// instances starting at once cannot apply the same migration twice
+const lockKey = 7_291_347_021
+
+// fileName matches "0001_create_users.up.sql" and its ".down.sql" pair
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes one migration and whether it has been applied
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	// Missing is set for versions recorded in the database that have no file
+	Missing bool
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a migrator for the SQL migrations embedded in the binary
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load(embedded)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load reads and orders the migrations in fsys. Every version needs both an
+// up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	byVersion := make(map[int64]*Migration)
+	err := fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration in order and returns those applied
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("applying %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied migrations, newest first
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+	done, err := appliedVersions(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := done[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &row.AppliedAt
+			delete(done, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, row := range done {
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, Status{
+			Version:   row.Version,
+			Name:      row.Name,
+			Applied:   true,
+			AppliedAt: &appliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Pending returns the number of migrations not yet applied
+func (m *Migrator) Pending() (int, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// locked runs fn on a single connection holding the migration advisory lock
+func (m *Migrator) locked(fn func(conn *gorm.DB) error) error {
+	return m.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+
+		if err := conn.AutoMigrate(&schemaMigration{}); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func appliedVersions(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	done := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+// Create writes an empty up/down pair for the next version into dir and
+// returns the paths of the new files
+func Create(dir, name string) ([]string, error) {
+	if !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(name) {
+		return nil, fmt.Errorf("migration name %q must be lower case letters, digits and underscores", name)
+	}
+	existing, err := Load(os.DirFS(dir))
+	if err != nil {
+		return nil, err
+	}
+	next := int64(1)
+	if len(existing) > 0 {
+		next = existing[len(existing)-1].Version + 1
+	}
+
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+		body := fmt.Sprintf("-- %s migration for %04d_%s\n", direction, next, name)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,150 @@
+package migrations
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0010_add_index.up.sql":      file("CREATE INDEX"),
+		"0010_add_index.down.sql":    file("DROP INDEX"),
+		"0002_users.up.sql":          file("CREATE TABLE users"),
+		"0002_users.down.sql":        file("DROP TABLE users"),
+		"README.md":                  file("ignored"),
+		"0003_Bad_Name.up.sql":       file("ignored"),
+		"nested/0001_first.up.sql":   file("CREATE TABLE first"),
+		"nested/0001_first.down.sql": file("DROP TABLE first"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, migration := range migrations {
+		got = append(got, migration.Name+":"+migration.Up+":"+migration.Down)
+	}
+	want := []string{"first:CREATE TABLE first:DROP TABLE first", "users:CREATE TABLE users:DROP TABLE users", "add_index:CREATE INDEX:DROP INDEX"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Load = %q, want %q ordered by version", got, want)
+	}
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		err  string
+	}{
+		{"up without down", fstest.MapFS{"0001_users.up.sql": file("x")}, "needs both an up and a down file"},
+		{"down without up", fstest.MapFS{"0001_users.down.sql": file("x")}, "needs both an up and a down file"},
+		{"two names", fstest.MapFS{"0001_users.up.sql": file("x"), "0001_people.down.sql": file("x")}, "has two names"},
+	}
+	for _, tt := range tests {
+		if _, err := Load(tt.fsys); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrator, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrator.migrations) == 0 {
+		t.Fatal("no migrations are embedded")
+	}
+	for i, migration := range migrator.migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s is at position %d, versions must be contiguous from 1", migration.Version, migration.Name, i+1)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := Create(dir, "create_users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || filepath.Base(paths[0]) != "0001_create_users.up.sql" || filepath.Base(paths[1]) != "0001_create_users.down.sql" {
+		t.Fatalf("first migration files = %v", paths)
+	}
+	paths, err = Create(dir, "add_email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(paths[0]) != "0002_add_email.up.sql" {
+		t.Errorf("second migration files = %v, want version 0002", paths)
+	}
+	if migrations, err := Load(os.DirFS(dir)); err != nil || len(migrations) != 2 {
+		t.Errorf("Load of created files = %d migrations, %v", len(migrations), err)
+	}
+
+	for _, name := range []string{"Add Email", "add-email", ""} {
+		if _, err := Create(dir, name); err == nil {
+			t.Errorf("Create(%q) succeeded, want the name rejected", name)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := &Migrator{db: db, migrations: []Migration{
+		{Version: 1, Name: "first"},
+		{Version: 2, Name: "second"},
+		{Version: 3, Name: "third"},
+	}}
+	if pending, err := migrator.Pending(); err != nil || pending != 3 {
+		t.Fatalf("Pending on an empty database = %d, %v, want 3", pending, err)
+	}
+
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, row := range []schemaMigration{{1, "first", appliedAt}, {4, "removed", appliedAt}} {
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		version          int64
+		applied, missing bool
+	}{
+		{1, true, false},
+		{2, false, false},
+		{3, false, false},
+		{4, true, true},
+	}
+	if len(statuses) != len(tests) {
+		t.Fatalf("Status = %+v, want %d entries", statuses, len(tests))
+	}
+	for i, tt := range tests {
+		status := statuses[i]
+		if status.Version != tt.version || status.Applied != tt.applied || status.Missing != tt.missing {
+			t.Errorf("status %d = %+v, want version %d applied %v missing %v", i, status, tt.version, tt.applied, tt.missing)
+		}
+		if status.Applied != (status.AppliedAt != nil) {
+			t.Errorf("version %d: AppliedAt = %v with Applied %v", status.Version, status.AppliedAt, status.Applied)
+		}
+	}
+	if pending, err := migrator.Pending(); err != nil || pending != 2 {
+		t.Errorf("Pending = %d, %v, want 2", pending, err)
+	}
+}
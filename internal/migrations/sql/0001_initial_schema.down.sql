@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS product_per_orders;
+DROP TABLE IF EXISTS shippings;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS repair_statuses;
+DROP TABLE IF EXISTS repairs;
+DROP TABLE IF EXISTS product_update_histories;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS brands;
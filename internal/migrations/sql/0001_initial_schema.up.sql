@@ -0,0 +1,82 @@
+-- Schema as it was created by AutoMigrate before versioned migrations.
+-- IF NOT EXISTS lets databases that were auto-migrated adopt this history.
+CREATE TABLE IF NOT EXISTS brands (
+    id         bigserial PRIMARY KEY,
+    name       text NOT NULL CONSTRAINT uni_brands_name UNIQUE,
+    created_at text NOT NULL,
+    updated_at text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id         bigserial PRIMARY KEY,
+    name       text NOT NULL CONSTRAINT uni_categories_name UNIQUE,
+    created_at text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS products (
+    id          bigserial PRIMARY KEY,
+    brand_id    bigint NOT NULL CONSTRAINT fk_brands_products REFERENCES brands (id),
+    name        text NOT NULL CONSTRAINT uni_products_name UNIQUE,
+    price       bigint NOT NULL,
+    stock       bigint NOT NULL,
+    category_id bigint NOT NULL CONSTRAINT fk_categories_products REFERENCES categories (id),
+    created_at  text NOT NULL,
+    updated_at  text NOT NULL,
+    update_by   text NOT NULL,
+    image_url   text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS product_update_histories (
+    id         bigserial PRIMARY KEY,
+    product_id bigint NOT NULL CONSTRAINT fk_product_update_histories_product REFERENCES products (id),
+    admin_id   text NOT NULL,
+    updated_at text NOT NULL,
+    summary    text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS repairs (
+    id          bigserial PRIMARY KEY,
+    user_id     text NOT NULL,
+    product     text NOT NULL,
+    category    text NOT NULL,
+    created_at  text NOT NULL,
+    updated_at  text NOT NULL,
+    description text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS repair_statuses (
+    id         bigserial PRIMARY KEY,
+    updated_by text NOT NULL,
+    updated_at text NOT NULL,
+    status     text NOT NULL,
+    repair_id  bigint NOT NULL CONSTRAINT fk_repairs_repair_status REFERENCES repairs (id)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id         bigserial PRIMARY KEY,
+    user_id    text NOT NULL,
+    created_at text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS shippings (
+    id         bigserial PRIMARY KEY,
+    address    text NOT NULL,
+    created_at text NOT NULL,
+    order_id   bigint NOT NULL CONSTRAINT uni_shippings_order_id UNIQUE
+        CONSTRAINT fk_orders_shipping REFERENCES orders (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS product_per_orders (
+    id         bigserial PRIMARY KEY,
+    order_id   bigint NOT NULL CONSTRAINT fk_orders_product_per_order REFERENCES orders (id),
+    product_id bigint NOT NULL CONSTRAINT fk_products_product_per_order REFERENCES products (id),
+    created_at text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id         bigserial PRIMARY KEY,
+    amount     bigint NOT NULL,
+    created_at text NOT NULL,
+    type       text NOT NULL,
+    order_id   bigint NOT NULL CONSTRAINT fk_orders_payment REFERENCES orders (id)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE repairs DROP CONSTRAINT IF EXISTS fk_users_repairs;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS fk_users_orders;
+ALTER TABLE repairs ALTER COLUMN user_id TYPE text USING user_id::text;
+ALTER TABLE orders ALTER COLUMN user_id TYPE text USING user_id::text;
+
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS users (
+    id            bigserial PRIMARY KEY,
+    email         text NOT NULL CONSTRAINT uni_users_email UNIQUE,
+    name          text NOT NULL,
+    password_hash text NOT NULL,
+    role          text NOT NULL DEFAULT 'customer',
+    created_at    text NOT NULL,
+    updated_at    text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id          bigserial PRIMARY KEY,
+    user_id     bigint NOT NULL CONSTRAINT fk_users_refresh_tokens REFERENCES users (id),
+    token_hash  text NOT NULL CONSTRAINT uni_refresh_tokens_token_hash UNIQUE,
+    family_id   text NOT NULL,
+    expires_at  timestamptz NOT NULL,
+    revoked_at  timestamptz,
+    replaced_by bigint,
+    created_at  timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+
+-- Orders and repairs used to carry free-form user strings. Numeric values
+-- become user IDs; anything else makes the cast fail so it can be fixed by hand.
+ALTER TABLE orders ALTER COLUMN user_id TYPE bigint USING user_id::bigint;
+ALTER TABLE repairs ALTER COLUMN user_id TYPE bigint USING user_id::bigint;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_users_orders') THEN
+        ALTER TABLE orders ADD CONSTRAINT fk_users_orders FOREIGN KEY (user_id) REFERENCES users (id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_users_repairs') THEN
+        ALTER TABLE repairs ADD CONSTRAINT fk_users_repairs FOREIGN KEY (user_id) REFERENCES users (id);
+    END IF;
+END $$;
@@ -0,0 +1,5 @@
+-- The original bucket URL cannot be rebuilt here, so image_url gets the bare key.
+ALTER TABLE products ADD COLUMN image_url text NOT NULL DEFAULT '';
+UPDATE products SET image_url = image_key;
+ALTER TABLE products ALTER COLUMN image_url DROP DEFAULT;
+ALTER TABLE products DROP COLUMN image_key;
@@ -0,0 +1,12 @@
+-- Products stored full S3 URLs in image_url; keep only the object key.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS image_key text NOT NULL DEFAULT '';
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'products' AND column_name = 'image_url') THEN
+        UPDATE products SET image_key = regexp_replace(image_url, '^.*/', '')
+        WHERE image_key = '' AND image_url <> '';
+        ALTER TABLE products DROP COLUMN image_url;
+    END IF;
+END $$;
@@ -0,0 +1,46 @@
+-- Restores the text columns as ISO dates.
+
+ALTER TABLE brands ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE brands ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE text USING to_char(updated_at, 'YYYY-MM-DD');
+
+ALTER TABLE categories ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE products ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE products ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE text USING to_char(updated_at, 'YYYY-MM-DD');
+
+ALTER TABLE product_update_histories ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE text USING to_char(updated_at, 'YYYY-MM-DD');
+
+ALTER TABLE repairs ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE repairs ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE text USING to_char(updated_at, 'YYYY-MM-DD');
+
+ALTER TABLE repair_statuses ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE text USING to_char(updated_at, 'YYYY-MM-DD');
+
+ALTER TABLE orders ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE shippings ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE product_per_orders ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE payments ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE users ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE text USING to_char(created_at, 'YYYY-MM-DD');
+
+ALTER TABLE users ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE text USING to_char(updated_at, 'YYYY-MM-DD');
@@ -0,0 +1,107 @@
+-- Timestamps were stored as text, mostly the literal '2023-10-01'.
+-- Values that look like dates are kept; anything else becomes now().
+
+ALTER TABLE brands ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE brands ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE timestamptz USING CASE
+        WHEN updated_at ~ '^\d{4}-\d{2}-\d{2}' THEN updated_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN updated_at SET DEFAULT now();
+
+ALTER TABLE categories ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE products ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE products ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE timestamptz USING CASE
+        WHEN updated_at ~ '^\d{4}-\d{2}-\d{2}' THEN updated_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN updated_at SET DEFAULT now();
+
+ALTER TABLE product_update_histories ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE timestamptz USING CASE
+        WHEN updated_at ~ '^\d{4}-\d{2}-\d{2}' THEN updated_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN updated_at SET DEFAULT now();
+
+ALTER TABLE repairs ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE repairs ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE timestamptz USING CASE
+        WHEN updated_at ~ '^\d{4}-\d{2}-\d{2}' THEN updated_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN updated_at SET DEFAULT now();
+
+ALTER TABLE repair_statuses ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE timestamptz USING CASE
+        WHEN updated_at ~ '^\d{4}-\d{2}-\d{2}' THEN updated_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN updated_at SET DEFAULT now();
+
+ALTER TABLE orders ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE shippings ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE product_per_orders ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE payments ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE users ALTER COLUMN created_at DROP DEFAULT,
+    ALTER COLUMN created_at TYPE timestamptz USING CASE
+        WHEN created_at ~ '^\d{4}-\d{2}-\d{2}' THEN created_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN created_at SET DEFAULT now();
+
+ALTER TABLE users ALTER COLUMN updated_at DROP DEFAULT,
+    ALTER COLUMN updated_at TYPE timestamptz USING CASE
+        WHEN updated_at ~ '^\d{4}-\d{2}-\d{2}' THEN updated_at::timestamptz
+        ELSE now()
+    END,
+    ALTER COLUMN updated_at SET DEFAULT now();
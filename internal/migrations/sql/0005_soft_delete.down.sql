@@ -0,0 +1,13 @@
+-- Soft deleted rows become visible again once the column is gone.
+
+DROP INDEX IF EXISTS idx_brands_deleted_at;
+ALTER TABLE brands DROP COLUMN IF EXISTS deleted_at;
+
+DROP INDEX IF EXISTS idx_categories_deleted_at;
+ALTER TABLE categories DROP COLUMN IF EXISTS deleted_at;
+
+DROP INDEX IF EXISTS idx_products_deleted_at;
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
+
+DROP INDEX IF EXISTS idx_orders_deleted_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS deleted_at;
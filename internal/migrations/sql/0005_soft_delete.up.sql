@@ -0,0 +1,14 @@
+-- Soft delete for catalog entities and orders; rows are purged after the
+-- retention period by the purge job.
+
+ALTER TABLE brands ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_brands_deleted_at ON brands (deleted_at);
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories (deleted_at);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+CREATE INDEX IF NOT EXISTS idx_orders_deleted_at ON orders (deleted_at);
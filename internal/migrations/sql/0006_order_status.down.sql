@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS order_status_histories;
+DROP INDEX IF EXISTS idx_orders_status;
+ALTER TABLE orders DROP COLUMN IF EXISTS status;
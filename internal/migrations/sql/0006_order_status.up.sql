@@ -0,0 +1,14 @@
+-- Orders get a lifecycle status; existing orders start out pending.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'pending';
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders (status);
+
+CREATE TABLE IF NOT EXISTS order_status_histories (
+    id          bigserial PRIMARY KEY,
+    order_id    bigint NOT NULL CONSTRAINT fk_orders_status_history REFERENCES orders (id),
+    from_status text NOT NULL,
+    to_status   text NOT NULL,
+    changed_by  text NOT NULL,
+    note        text NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_order_status_histories_order_id ON order_status_histories (order_id);
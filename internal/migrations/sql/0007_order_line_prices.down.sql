@@ -0,0 +1 @@
+ALTER TABLE product_per_orders DROP COLUMN IF EXISTS unit_price;
@@ -0,0 +1,7 @@
+-- Order lines keep the price paid; existing lines take the current price.
+ALTER TABLE product_per_orders ADD COLUMN IF NOT EXISTS unit_price bigint NOT NULL DEFAULT 0;
+
+UPDATE product_per_orders
+SET unit_price = products.price
+FROM products
+WHERE products.id = product_per_orders.product_id AND product_per_orders.unit_price = 0;
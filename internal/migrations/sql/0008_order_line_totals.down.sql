@@ -0,0 +1,4 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS total;
+ALTER TABLE product_per_orders DROP COLUMN IF EXISTS line_total;
+ALTER TABLE product_per_orders DROP COLUMN IF EXISTS discount;
+ALTER TABLE product_per_orders DROP COLUMN IF EXISTS quantity;
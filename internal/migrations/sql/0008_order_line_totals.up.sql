@@ -0,0 +1,9 @@
+-- Each existing line stands for a single unit without a discount.
+ALTER TABLE product_per_orders ADD COLUMN IF NOT EXISTS quantity bigint NOT NULL DEFAULT 1;
+ALTER TABLE product_per_orders ADD COLUMN IF NOT EXISTS discount bigint NOT NULL DEFAULT 0;
+ALTER TABLE product_per_orders ADD COLUMN IF NOT EXISTS line_total bigint NOT NULL DEFAULT 0;
+UPDATE product_per_orders SET line_total = quantity * unit_price - discount;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS total bigint NOT NULL DEFAULT 0;
+UPDATE orders SET total = COALESCE(
+    (SELECT SUM(line_total) FROM product_per_orders WHERE product_per_orders.order_id = orders.id), 0);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id                   bigserial PRIMARY KEY,
+    product_id           bigint NOT NULL CONSTRAINT fk_stock_reservations_product REFERENCES products (id),
+    order_id             bigint NOT NULL CONSTRAINT fk_stock_reservations_order REFERENCES orders (id),
+    product_per_order_id bigint NOT NULL CONSTRAINT fk_stock_reservations_product_per_order REFERENCES product_per_orders (id),
+    quantity             bigint NOT NULL,
+    status               text NOT NULL DEFAULT 'held',
+    expires_at           timestamptz NOT NULL,
+    created_at           timestamptz NOT NULL DEFAULT now(),
+    updated_at           timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_product_id ON stock_reservations (product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_order_id ON stock_reservations (order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_product_per_order_id ON stock_reservations (product_per_order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_status ON stock_reservations (status);
@@ -0,0 +1,35 @@
+-- Append-only stock ledger. Rows outlive purged products and orders, so
+-- there are no foreign keys to them.
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id         bigserial PRIMARY KEY,
+    product_id bigint NOT NULL,
+    kind       text NOT NULL CONSTRAINT chk_stock_movements_kind
+        CHECK (kind IN ('receipt', 'sale', 'return', 'adjustment', 'repair_part', 'transfer')),
+    quantity   bigint NOT NULL CONSTRAINT chk_stock_movements_quantity CHECK (quantity <> 0),
+    reason     text NOT NULL DEFAULT '',
+    actor      text NOT NULL,
+    order_id   bigint,
+    repair_id  bigint,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product_id ON stock_movements (product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_order_id ON stock_movements (order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_repair_id ON stock_movements (repair_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_created_at ON stock_movements (created_at);
+
+CREATE OR REPLACE FUNCTION stock_movements_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'stock_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS stock_movements_append_only ON stock_movements;
+CREATE TRIGGER stock_movements_append_only
+    BEFORE UPDATE OR DELETE ON stock_movements
+    FOR EACH ROW EXECUTE FUNCTION stock_movements_append_only();
+
+-- Open the ledger with the stock each product has today
+INSERT INTO stock_movements (product_id, kind, quantity, reason, actor)
+SELECT id, 'adjustment', stock, 'opening balance', 'system'
+FROM products
+WHERE stock <> 0;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS entity_changes (
+    id          bigserial PRIMARY KEY,
+    entity_type text NOT NULL,
+    entity_id   bigint NOT NULL,
+    action      text NOT NULL,
+    actor       text NOT NULL,
+    changes     jsonb NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_entity_changes_entity ON entity_changes (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS idx_entity_changes_actor ON entity_changes (actor);
+CREATE INDEX IF NOT EXISTS idx_entity_changes_created_at ON entity_changes (created_at);
@@ -0,0 +1,8 @@
+ALTER TABLE repair_statuses DROP COLUMN IF EXISTS version;
+ALTER TABLE repairs DROP COLUMN IF EXISTS version;
+ALTER TABLE shippings DROP COLUMN IF EXISTS version;
+ALTER TABLE payments DROP COLUMN IF EXISTS version;
+ALTER TABLE orders DROP COLUMN IF EXISTS version;
+ALTER TABLE products DROP COLUMN IF EXISTS version;
+ALTER TABLE categories DROP COLUMN IF EXISTS version;
+ALTER TABLE brands DROP COLUMN IF EXISTS version;
@@ -0,0 +1,23 @@
+-- Currencies are dropped, so every amount is read back as whole kyat.
+ALTER TABLE payments DROP COLUMN amount_currency;
+UPDATE payments SET amount_minor = amount_minor / 100;
+ALTER TABLE payments RENAME COLUMN amount_minor TO amount;
+
+ALTER TABLE product_per_orders DROP COLUMN line_total_currency;
+ALTER TABLE product_per_orders DROP COLUMN discount_currency;
+ALTER TABLE product_per_orders DROP COLUMN unit_price_currency;
+UPDATE product_per_orders SET
+    unit_price_minor = unit_price_minor / 100,
+    discount_minor = discount_minor / 100,
+    line_total_minor = line_total_minor / 100;
+ALTER TABLE product_per_orders RENAME COLUMN line_total_minor TO line_total;
+ALTER TABLE product_per_orders RENAME COLUMN discount_minor TO discount;
+ALTER TABLE product_per_orders RENAME COLUMN unit_price_minor TO unit_price;
+
+ALTER TABLE orders DROP COLUMN total_currency;
+UPDATE orders SET total_minor = total_minor / 100;
+ALTER TABLE orders RENAME COLUMN total_minor TO total;
+
+ALTER TABLE products DROP COLUMN price_currency;
+UPDATE products SET price_minor = price_minor / 100;
+ALTER TABLE products RENAME COLUMN price_minor TO price;
@@ -0,0 +1,24 @@
+-- Amounts become minor units with an ISO 4217 currency. Existing amounts
+-- are whole kyat, and MMK has two minor unit digits.
+ALTER TABLE products RENAME COLUMN price TO price_minor;
+UPDATE products SET price_minor = price_minor * 100;
+ALTER TABLE products ADD COLUMN price_currency text NOT NULL DEFAULT 'MMK';
+
+ALTER TABLE orders RENAME COLUMN total TO total_minor;
+UPDATE orders SET total_minor = total_minor * 100;
+ALTER TABLE orders ADD COLUMN total_currency text NOT NULL DEFAULT 'MMK';
+
+ALTER TABLE product_per_orders RENAME COLUMN unit_price TO unit_price_minor;
+ALTER TABLE product_per_orders RENAME COLUMN discount TO discount_minor;
+ALTER TABLE product_per_orders RENAME COLUMN line_total TO line_total_minor;
+UPDATE product_per_orders SET
+    unit_price_minor = unit_price_minor * 100,
+    discount_minor = discount_minor * 100,
+    line_total_minor = line_total_minor * 100;
+ALTER TABLE product_per_orders ADD COLUMN unit_price_currency text NOT NULL DEFAULT 'MMK';
+ALTER TABLE product_per_orders ADD COLUMN discount_currency text NOT NULL DEFAULT 'MMK';
+ALTER TABLE product_per_orders ADD COLUMN line_total_currency text NOT NULL DEFAULT 'MMK';
+
+ALTER TABLE payments RENAME COLUMN amount TO amount_minor;
+UPDATE payments SET amount_minor = amount_minor * 100;
+ALTER TABLE payments ADD COLUMN amount_currency text NOT NULL DEFAULT 'MMK';
@@ -0,0 +1,4 @@
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE stock_reservations DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE product_per_orders DROP COLUMN IF EXISTS variant_id;
+DROP TABLE IF EXISTS product_variants;
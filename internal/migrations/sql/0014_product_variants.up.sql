@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS product_variants (
+    id             bigserial PRIMARY KEY,
+    version        bigint NOT NULL DEFAULT 1,
+    product_id     bigint NOT NULL CONSTRAINT fk_products_variants REFERENCES products (id),
+    sku            text NOT NULL CONSTRAINT uni_product_variants_sku UNIQUE,
+    options        jsonb NOT NULL DEFAULT '{}',
+    price_minor    bigint NOT NULL DEFAULT 0,
+    price_currency text NOT NULL DEFAULT 'MMK',
+    stock          bigint NOT NULL DEFAULT 0,
+    image_key      text NOT NULL DEFAULT '',
+    created_at     timestamptz NOT NULL DEFAULT now(),
+    updated_at     timestamptz NOT NULL DEFAULT now(),
+    deleted_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_id ON product_variants (product_id);
+CREATE INDEX IF NOT EXISTS idx_product_variants_deleted_at ON product_variants (deleted_at);
+
+ALTER TABLE product_per_orders ADD COLUMN IF NOT EXISTS variant_id bigint
+    CONSTRAINT fk_product_per_orders_variant REFERENCES product_variants (id);
+CREATE INDEX IF NOT EXISTS idx_product_per_orders_variant_id ON product_per_orders (variant_id);
+
+ALTER TABLE stock_reservations ADD COLUMN IF NOT EXISTS variant_id bigint
+    CONSTRAINT fk_stock_reservations_variant REFERENCES product_variants (id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_variant_id ON stock_reservations (variant_id);
+
+-- Like the rest of the ledger, no foreign key so entries outlive variants
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS variant_id bigint;
+CREATE INDEX IF NOT EXISTS idx_stock_movements_variant_id ON stock_movements (variant_id);
@@ -0,0 +1,8 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS image_key text NOT NULL DEFAULT '';
+
+-- Only the primary image survives; the others stay in storage unreferenced
+UPDATE products SET image_key = product_images.image_key
+FROM product_images
+WHERE product_images.product_id = products.id AND product_images.is_primary;
+
+DROP TABLE IF EXISTS product_images;
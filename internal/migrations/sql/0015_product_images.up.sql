@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS product_images (
+    id         bigserial PRIMARY KEY,
+    product_id bigint NOT NULL CONSTRAINT fk_products_images REFERENCES products (id),
+    image_key  text NOT NULL,
+    position   bigint NOT NULL DEFAULT 0,
+    alt_text   text NOT NULL DEFAULT '',
+    is_primary boolean NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_product_images_product_id ON product_images (product_id);
+-- At most one primary image per product
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_images_primary ON product_images (product_id) WHERE is_primary;
+
+-- Each product's single image becomes its first, primary image
+INSERT INTO product_images (product_id, image_key, position, is_primary, created_at)
+SELECT id, image_key, 0, true, created_at FROM products WHERE image_key <> '';
+
+ALTER TABLE products DROP COLUMN IF EXISTS image_key;
@@ -0,0 +1,5 @@
+-- Rendition objects stay in storage unreferenced
+ALTER TABLE product_images DROP COLUMN IF EXISTS renditions;
+ALTER TABLE product_images DROP COLUMN IF EXISTS height;
+ALTER TABLE product_images DROP COLUMN IF EXISTS width;
+ALTER TABLE product_images DROP COLUMN IF EXISTS content_type;
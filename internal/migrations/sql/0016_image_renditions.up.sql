@@ -0,0 +1,6 @@
+-- Images uploaded before processing existed keep an empty rendition map
+-- and unknown dimensions; responses fall back to the original
+ALTER TABLE product_images ADD COLUMN IF NOT EXISTS content_type text NOT NULL DEFAULT '';
+ALTER TABLE product_images ADD COLUMN IF NOT EXISTS width bigint NOT NULL DEFAULT 0;
+ALTER TABLE product_images ADD COLUMN IF NOT EXISTS height bigint NOT NULL DEFAULT 0;
+ALTER TABLE product_images ADD COLUMN IF NOT EXISTS renditions jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+ALTER TABLE product_variants DROP COLUMN IF EXISTS image_name;
+ALTER TABLE product_images DROP COLUMN IF EXISTS original_name;
@@ -0,0 +1,4 @@
+-- Uploads are now stored under content hash keys; the client's file name
+-- is kept here instead. Earlier uploads keep their old keys and no name.
+ALTER TABLE product_images ADD COLUMN IF NOT EXISTS original_name text NOT NULL DEFAULT '';
+ALTER TABLE product_variants ADD COLUMN IF NOT EXISTS image_name text NOT NULL DEFAULT '';
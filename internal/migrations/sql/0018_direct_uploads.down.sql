@@ -0,0 +1,3 @@
+-- Objects of pending uploads and repair images stay in storage unreferenced
+DROP TABLE IF EXISTS pending_uploads;
+DROP TABLE IF EXISTS repair_images;
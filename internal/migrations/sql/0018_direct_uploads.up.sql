@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS repair_images (
+    id            bigserial PRIMARY KEY,
+    repair_id     bigint NOT NULL CONSTRAINT fk_repairs_images REFERENCES repairs (id),
+    image_key     text NOT NULL,
+    original_name text NOT NULL DEFAULT '',
+    content_type  text NOT NULL,
+    width         bigint NOT NULL,
+    height        bigint NOT NULL,
+    created_at    timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_repair_images_repair_id ON repair_images (repair_id);
+
+-- Uploads a client was given a presigned URL for and has not completed
+CREATE TABLE IF NOT EXISTS pending_uploads (
+    id           bigserial PRIMARY KEY,
+    object_key   text NOT NULL UNIQUE,
+    target_type  text NOT NULL,
+    target_id    bigint NOT NULL,
+    file_name    text NOT NULL DEFAULT '',
+    content_type text NOT NULL,
+    size         bigint NOT NULL,
+    created_by   text NOT NULL,
+    expires_at   timestamptz NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_pending_uploads_expires_at ON pending_uploads (expires_at);
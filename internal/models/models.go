@@ -1,92 +1,437 @@
 package models
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type User struct {
+	ID            uint           `gorm:"primaryKey;autoIncrement"`
+	Email         string         `gorm:"unique;not null"`
+	Name          string         `gorm:"not null"`
+	PasswordHash  string         `gorm:"not null" json:"-"`
+	Role          string         `gorm:"not null;default:customer"`
+	Orders        []Order        `gorm:"foreignKey:UserId" json:",omitempty"`
+	Repairs       []Repair       `gorm:"foreignKey:UserId" json:",omitempty"`
+	RefreshTokens []RefreshToken `gorm:"foreignKey:UserID" json:"-"`
+	CreatedAt     time.Time      `gorm:"not null;autoCreateTime"`
+	UpdatedAt     time.Time      `gorm:"not null;autoUpdateTime"`
+}
+
+// RefreshToken stores the hash of an issued refresh token. Tokens rotated
+// from the same login share a FamilyID so reuse of a rotated token can
+// revoke the whole family.
+type RefreshToken struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	UserID     uint      `gorm:"not null;index"` // Foreign key
+	TokenHash  string    `gorm:"unique;not null"`
+	FamilyID   string    `gorm:"not null;index"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+	ReplacedBy *uint
+	CreatedAt  time.Time `gorm:"not null"`
+}
+
 type Category struct {
-	ID        uint      `gorm:"primaryKey;autoIncrement"`
-	Name      string    `gorm:"unique;not null"`
-	Products  []Product `gorm:"foreignKey:CategoryID"`
-	CreatedAt string    `gorm:"not null"`
+	ID        uint           `gorm:"primaryKey;autoIncrement"`
+	Version   uint           `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	Name      string         `gorm:"unique;not null"`
+	Products  []Product      `gorm:"foreignKey:CategoryID"`
+	CreatedAt time.Time      `gorm:"not null;autoCreateTime"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Product struct {
 	ID              uint              `gorm:"primaryKey;autoIncrement"`
-	BrandID         uint              `gorm:"not null"` // Foreign key
+	Version         uint              `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	BrandID         uint              `gorm:"not null"`           // Foreign key
 	Brand           Brand             `gorm:"foreignKey:BrandID"`
 	Name            string            `gorm:"unique;not null"`
-	Price           int               `gorm:"not null"`
+	Price           Money             `gorm:"embedded;embeddedPrefix:price_"`
 	Stock           int               `gorm:"not null"`
 	CategoryID      uint              `gorm:"not null"` // Foreign key
 	Category        Category          `gorm:"foreignKey:CategoryID"`
-	CreatedAt       string            `gorm:"not null"`
-	UpdatedAt       string            `gorm:"not null"`
+	CreatedAt       time.Time         `gorm:"not null;autoCreateTime"`
+	UpdatedAt       time.Time         `gorm:"not null;autoUpdateTime"`
+	DeletedAt       gorm.DeletedAt    `gorm:"index"`
 	UpdateBy        string            `gorm:"not null"`
 	ProductPerOrder []ProductPerOrder `gorm:"foreignKey:ProductID"`
-	ImageURL        string            `gorm:"not null"`
+	Variants        []ProductVariant  `gorm:"foreignKey:ProductID"`
+	Images          []ProductImage    `gorm:"foreignKey:ProductID"`
+	ImageURL        string            `gorm:"-"` // URL of the primary image, resolved for responses
+}
+
+// ProductImage is one picture of a product. Images are shown in Position
+// order and a product with images has exactly one primary image.
+type ProductImage struct {
+	ID           uint            `gorm:"primaryKey;autoIncrement"`
+	ProductID    uint            `gorm:"not null;index"`      // Foreign key
+	ImageKey     string          `gorm:"not null"`            // Storage object key of the original
+	ImageURL     string          `gorm:"-"`                   // Resolved from ImageKey for responses
+	OriginalName string          `gorm:"not null;default:''"` // Sanitized name of the uploaded file
+	ContentType  string          `gorm:"not null;default:''"`
+	Width        int             `gorm:"not null;default:0"`
+	Height       int             `gorm:"not null;default:0"`
+	Renditions   ImageRenditions `gorm:"type:jsonb;not null;default:'{}'"` // Scaled WebP copies by name
+	SrcSet       string          `gorm:"-"`                                // Built from Renditions for responses
+	Position     int             `gorm:"not null;default:0"`
+	AltText      string          `gorm:"not null;default:''"`
+	IsPrimary    bool            `gorm:"not null;default:false"`
+	CreatedAt    time.Time       `gorm:"not null;autoCreateTime"`
+}
+
+// ObjectKeys lists every stored object of the image once, original first.
+// Keys follow content, so an image too small to be scaled shares its
+// renditions' objects.
+func (image ProductImage) ObjectKeys() []string {
+	keys := []string{image.ImageKey}
+	for _, rendition := range image.Renditions {
+		if !slices.Contains(keys, rendition.Key) {
+			keys = append(keys, rendition.Key)
+		}
+	}
+	return keys
+}
+
+// ImageRendition is a scaled copy of an image
+type ImageRendition struct {
+	Key    string // Storage object key
+	URL    string // Resolved from Key for responses
+	Width  int
+	Height int
+}
+
+// ImageRenditions maps rendition names such as "thumbnail" to the
+// rendition and is stored as JSON, without the resolved URLs
+type ImageRenditions map[string]ImageRendition
+
+type storedRendition struct {
+	Key    string `json:"key"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func (renditions ImageRenditions) Value() (driver.Value, error) {
+	stored := make(map[string]storedRendition, len(renditions))
+	for name, rendition := range renditions {
+		stored[name] = storedRendition{Key: rendition.Key, Width: rendition.Width, Height: rendition.Height}
+	}
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
+
+func (renditions *ImageRenditions) Scan(value interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	case nil:
+		*renditions = nil
+		return nil
+	default:
+		return errors.New("unsupported type for ImageRenditions")
+	}
+	var stored map[string]storedRendition
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*renditions = make(ImageRenditions, len(stored))
+	for name, rendition := range stored {
+		(*renditions)[name] = ImageRendition{Key: rendition.Key, Width: rendition.Width, Height: rendition.Height}
+	}
+	return nil
+}
+
+// ProductVariant is a sellable version of a product, such as one color and
+// storage size of a phone. Products with variants sell, stock and reserve
+// per variant; the product's stock is the sum over its variants.
+type ProductVariant struct {
+	ID        uint           `gorm:"primaryKey;autoIncrement"`
+	Version   uint           `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	ProductID uint           `gorm:"not null;index"`     // Foreign key
+	SKU       string         `gorm:"column:sku;unique;not null"`
+	Options   VariantOptions `gorm:"type:jsonb;not null"`
+	Price     Money          `gorm:"embedded;embeddedPrefix:price_"`
+	Stock     int            `gorm:"not null;default:0"`
+	ImageKey  string         `gorm:"not null;default:''"` // Storage object key
+	ImageName string         `gorm:"not null;default:''"` // Sanitized name of the uploaded file
+	ImageURL  string         `gorm:"-"`                   // Resolved from ImageKey for responses
+	CreatedAt time.Time      `gorm:"not null;autoCreateTime"`
+	UpdatedAt time.Time      `gorm:"not null;autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// VariantOptions maps option names such as "color" or "storage" to the
+// variant's value and is stored as JSON
+type VariantOptions map[string]string
+
+func (options VariantOptions) Value() (driver.Value, error) {
+	if options == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(options)
+	return string(data), err
+}
+
+func (options *VariantOptions) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, options)
+	case string:
+		return json.Unmarshal([]byte(data), options)
+	case nil:
+		*options = nil
+		return nil
+	}
+	return errors.New("unsupported type for VariantOptions")
 }
 
 type Brand struct {
-	ID        uint      `gorm:"primaryKey;autoIncrement"`
-	Name      string    `gorm:"unique;not null"`
-	Products  []Product `gorm:"foreignKey:BrandID"`
-	CreatedAt string    `gorm:"not null"`
-	UpdatedAt string    `gorm:"not null"`
+	ID        uint           `gorm:"primaryKey;autoIncrement"`
+	Version   uint           `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	Name      string         `gorm:"unique;not null"`
+	Products  []Product      `gorm:"foreignKey:BrandID"`
+	CreatedAt time.Time      `gorm:"not null;autoCreateTime"`
+	UpdatedAt time.Time      `gorm:"not null;autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type ProductUpdateHistory struct {
-	ID        uint    `gorm:"primaryKey;autoIncrement"`
-	ProductID uint    `gorm:"not null"` // Foreign key
-	Product   Product `gorm:"foreignKey:ProductID"`
-	AdminID   string  `gorm:"not null"` // Foreign key
-	UpdatedAt string  `gorm:"not null"`
-	Summary   string  `gorm:"not null"`
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	ProductID uint      `gorm:"not null"` // Foreign key
+	Product   Product   `gorm:"foreignKey:ProductID"`
+	AdminID   string    `gorm:"not null"` // Foreign key
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime"`
+	Summary   string    `gorm:"not null"`
 }
 
 type RepairStatus struct {
-	ID        uint   `gorm:"primaryKey;autoIncrement"`
-	UpdatedBy string `gorm:"not null"`
-	UpdatedAt string `gorm:"not null"`
-	Status    string `gorm:"not null"`
-	RepairID  uint   `gorm:"not null"` // Foreign key
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Version   uint      `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	UpdatedBy string    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime"`
+	Status    string    `gorm:"not null"`
+	RepairID  uint      `gorm:"not null"` // Foreign key
 }
 
 type Repair struct {
 	ID           uint           `gorm:"primaryKey;autoIncrement"`
-	UserId       string         `gorm:"not null"` // Foreign key
+	Version      uint           `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	UserId       uint           `gorm:"not null"`           // Foreign key
+	User         *User          `gorm:"foreignKey:UserId" json:",omitempty"`
 	RepairStatus []RepairStatus `gorm:"foreignKey:RepairID"`
+	Images       []RepairImage  `gorm:"foreignKey:RepairID"`
 	Product      string         `gorm:"not null"`
 	Category     string         `gorm:"not null"`
-	CreatedAt    string         `gorm:"not null"`
-	UpdatedAt    string         `gorm:"not null"`
+	CreatedAt    time.Time      `gorm:"not null;autoCreateTime"`
+	UpdatedAt    time.Time      `gorm:"not null;autoUpdateTime"`
 	Description  string         `gorm:"not null"`
 }
 
+// RepairImage is a picture attached to a repair, such as a photo of the
+// damage. It is validated and stripped like a product image but has no
+// renditions.
+type RepairImage struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement"`
+	RepairID     uint      `gorm:"not null;index"`      // Foreign key
+	ImageKey     string    `gorm:"not null"`            // Storage object key
+	ImageURL     string    `gorm:"-"`                   // Resolved from ImageKey for responses
+	OriginalName string    `gorm:"not null;default:''"` // Sanitized name of the uploaded file
+	ContentType  string    `gorm:"not null"`
+	Width        int       `gorm:"not null"`
+	Height       int       `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"not null;autoCreateTime"`
+}
+
+// Targets a direct upload can be attached to
+const (
+	UploadTargetProduct = "product"
+	UploadTargetRepair  = "repair"
+)
+
+// PendingUpload is a direct upload a client was given a presigned URL for.
+// Completing it attaches the object to its target and removes the row;
+// uploads not completed by ExpiresAt are swept together with their object.
+type PendingUpload struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement"`
+	ObjectKey   string    `gorm:"not null;unique"` // Staging key the client uploads to
+	TargetType  string    `gorm:"not null"`
+	TargetID    uint      `gorm:"not null"`
+	FileName    string    `gorm:"not null;default:''"` // Sanitized name the client gave
+	ContentType string    `gorm:"not null"`
+	Size        int64     `gorm:"not null"`
+	CreatedBy   string    `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time `gorm:"not null;autoCreateTime"`
+}
+
+// Order statuses. Allowed moves between them are enforced by
+// services.OrderService.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusPacked    = "packed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
 type Order struct {
-	ID              uint              `gorm:"primaryKey;autoIncrement"`
-	UserId          string            `gorm:"not null"` // Foreign key
-	ProductPerOrder []ProductPerOrder `gorm:"foreignKey:OrderID"`
-	CreatedAt       string            `gorm:"not null"`
-	Payment         Payment           `gorm:"foreignKey:OrderID"`
-	Shipping        Shipping          `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	ID              uint                 `gorm:"primaryKey;autoIncrement"`
+	Version         uint                 `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	UserId          uint                 `gorm:"not null"`           // Foreign key
+	User            *User                `gorm:"foreignKey:UserId" json:",omitempty"`
+	Status          string               `gorm:"not null;default:pending;index"`
+	Total           Money                `gorm:"embedded;embeddedPrefix:total_"` // Sum of the line totals
+	StatusHistory   []OrderStatusHistory `gorm:"foreignKey:OrderID" json:",omitempty"`
+	ProductPerOrder []ProductPerOrder    `gorm:"foreignKey:OrderID"`
+	CreatedAt       time.Time            `gorm:"not null;autoCreateTime"`
+	DeletedAt       gorm.DeletedAt       `gorm:"index"`
+	Payment         Payment              `gorm:"foreignKey:OrderID"`
+	Shipping        Shipping             `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+}
+
+// OrderStatusHistory records one status transition of an order
+type OrderStatusHistory struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement"`
+	OrderID    uint      `gorm:"not null;index"` // Foreign key
+	FromStatus string    `gorm:"not null"`
+	ToStatus   string    `gorm:"not null"`
+	ChangedBy  string    `gorm:"not null"`
+	Note       string    `gorm:"not null;default:''"`
+	CreatedAt  time.Time `gorm:"not null;autoCreateTime"`
+}
+
+// Stock reservation statuses
+const (
+	ReservationHeld      = "held"
+	ReservationReleased  = "released"
+	ReservationConverted = "converted"
+)
+
+// StockReservation holds stock for an order line until the order is paid,
+// when it is converted into a stock decrement, or until it is released by
+// cancellation or expiry
+type StockReservation struct {
+	ID                uint      `gorm:"primaryKey;autoIncrement"`
+	ProductID         uint      `gorm:"not null;index"` // Foreign key
+	OrderID           uint      `gorm:"not null;index"` // Foreign key
+	ProductPerOrderID uint      `gorm:"not null;index"` // Foreign key
+	VariantID         *uint     `gorm:"index"`          // Foreign key
+	Quantity          int       `gorm:"not null"`
+	Status            string    `gorm:"not null;default:held;index"`
+	ExpiresAt         time.Time `gorm:"not null"`
+	CreatedAt         time.Time `gorm:"not null;autoCreateTime"`
+	UpdatedAt         time.Time `gorm:"not null;autoUpdateTime"`
+}
+
+// Stock movement kinds
+const (
+	MovementReceipt    = "receipt"
+	MovementSale       = "sale"
+	MovementReturn     = "return"
+	MovementAdjustment = "adjustment"
+	MovementRepairPart = "repair_part"
+	MovementTransfer   = "transfer"
+)
+
+// StockMovement is an append-only ledger entry. Product.Stock always equals
+// the sum of the product's movement quantities, and ProductVariant.Stock
+// the sum of the movements booked to that variant.
+type StockMovement struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	ProductID uint      `gorm:"not null;index"`
+	VariantID *uint     `gorm:"index"`
+	Kind      string    `gorm:"not null"`
+	Quantity  int       `gorm:"not null"` // Signed change to the stock on hand
+	Reason    string    `gorm:"not null;default:''"`
+	Actor     string    `gorm:"not null"`
+	OrderID   *uint     `gorm:"index"`
+	RepairID  *uint     `gorm:"index"`
+	CreatedAt time.Time `gorm:"not null;autoCreateTime;index"`
 }
 
 type Shipping struct {
-	ID        uint   `gorm:"primaryKey;autoIncrement"`
-	Address   string `gorm:"not null"`
-	CreatedAt string `gorm:"not null"`
-	OrderID   uint   `gorm:"unique;not null"` // One-to-one relationship
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Version   uint      `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	Address   string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null;autoCreateTime"`
+	OrderID   uint      `gorm:"unique;not null"` // One-to-one relationship
 }
 type ProductPerOrder struct {
-	ID        uint    `gorm:"primaryKey;autoIncrement"`
-	OrderID   uint    `gorm:"not null"` // Foreign key
-	ProductID uint    `gorm:"not null"` // Foreign key
-	CreatedAt string  `gorm:"not null"`
-	Order     Order   `gorm:"foreignKey:OrderID"`
-	Product   Product `gorm:"foreignKey:ProductID"`
+	ID        uint            `gorm:"primaryKey;autoIncrement"`
+	OrderID   uint            `gorm:"not null"` // Foreign key
+	ProductID uint            `gorm:"not null"` // Foreign key
+	VariantID *uint           `gorm:"index"`    // Foreign key, set for products with variants
+	Quantity  int             `gorm:"not null;default:1"`
+	UnitPrice Money           `gorm:"embedded;embeddedPrefix:unit_price_"` // Product price when the order was placed
+	Discount  Money           `gorm:"embedded;embeddedPrefix:discount_"`   // Amount taken off the whole line
+	LineTotal Money           `gorm:"embedded;embeddedPrefix:line_total_"` // Quantity * UnitPrice - Discount
+	CreatedAt time.Time       `gorm:"not null;autoCreateTime"`
+	Order     Order           `gorm:"foreignKey:OrderID"`
+	Product   Product         `gorm:"foreignKey:ProductID"`
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:",omitempty"`
 }
 
 type Payment struct {
-	ID        uint   `gorm:"primaryKey;autoIncrement"`
-	Amount    int    `gorm:"not null"`
-	CreatedAt string `gorm:"not null"`
-	Type      string `gorm:"not null"`
-	OrderID   uint   `gorm:"not null"` // Foreign key
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Version   uint      `gorm:"not null;default:1"` // Optimistic lock, sent as the ETag
+	Amount    Money     `gorm:"embedded;embeddedPrefix:amount_"`
+	CreatedAt time.Time `gorm:"not null;autoCreateTime"`
+	Type      string    `gorm:"not null"`
+	OrderID   uint      `gorm:"not null"` // Foreign key
+}
+
+// Entity change actions
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// FieldChange holds a column's value before and after a write
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// FieldChanges maps column names to their change and is stored as JSON
+type FieldChanges map[string]FieldChange
+
+func (changes FieldChanges) Value() (driver.Value, error) {
+	data, err := json.Marshal(changes)
+	return string(data), err
+}
+
+func (changes *FieldChanges) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, changes)
+	case string:
+		return json.Unmarshal([]byte(data), changes)
+	case nil:
+		*changes = nil
+		return nil
+	}
+	return errors.New("unsupported type for FieldChanges")
+}
+
+// EntityChange is a field level record of one create, update or delete,
+// written automatically by the audit callbacks
+type EntityChange struct {
+	ID         uint         `gorm:"primaryKey;autoIncrement"`
+	EntityType string       `gorm:"not null;index:idx_entity_changes_entity"`
+	EntityID   uint         `gorm:"not null;index:idx_entity_changes_entity"`
+	Action     string       `gorm:"not null"`
+	Actor      string       `gorm:"not null;index"`
+	Changes    FieldChanges `gorm:"type:jsonb;not null"`
+	CreatedAt  time.Time    `gorm:"not null;autoCreateTime;index"`
 }
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts given without a currency
+const DefaultCurrency = "MMK"
+
+// currencyExponents lists the supported ISO 4217 currencies with the
+// number of minor unit digits each has
+var currencyExponents = map[string]int{
+	"MMK": 2,
+	"USD": 2,
+	"EUR": 2,
+	"SGD": 2,
+	"THB": 2,
+	"JPY": 0,
+}
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrCurrencyMismatch = errors.New("currencies do not match")
+)
+
+// Money is an amount in the minor units of its currency, so 12.50 MMK is
+// stored as 1250. Models embed it with a prefix, giving <prefix>minor and
+// <prefix>currency columns.
+type Money struct {
+	Amount   int64  `gorm:"column:minor;not null;default:0"`
+	Currency string `gorm:"column:currency;not null;default:MMK"`
+}
+
+// NormalizeCurrency upper cases an ISO 4217 code, defaulting an empty one
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency, nil
+	}
+	if _, ok := currencyExponents[currency]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return currency, nil
+}
+
+// NewMoney returns amount minor units of currency
+func NewMoney(amount int64, currency string) (Money, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// ParseMoney parses a non-negative decimal amount in major units, such as
+// "12.50", rejecting more fraction digits than the currency has
+func ParseMoney(value, currency string) (Money, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	exponent := currencyExponents[currency]
+
+	value = strings.TrimSpace(value)
+	whole, fraction, hasFraction := strings.Cut(value, ".")
+	if whole == "" || !digits(whole) || (hasFraction && (fraction == "" || !digits(fraction))) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%w: %s allows %d decimal places", ErrInvalidAmount, currency, exponent)
+	}
+
+	amount, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, value)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func digits(value string) bool {
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// currency returns the currency, treating an empty one as the default
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// Zero returns a zero amount in the same currency as m
+func (m Money) Zero() Money {
+	return Money{Currency: m.currency()}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// SameCurrency reports whether m and other can be combined
+func (m Money) SameCurrency(other Money) bool {
+	return m.currency() == other.currency()
+}
+
+// Equal reports whether m and other are the same amount of the same currency
+func (m Money) Equal(other Money) bool {
+	return m.Amount == other.Amount && m.SameCurrency(other)
+}
+
+// Add returns m + other
+func (m Money) Add(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency(), other.currency())
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currency()}, nil
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Mul returns m multiplied by quantity
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.currency()}
+}
+
+// String formats m in major units, such as "12.50 MMK"
+func (m Money) String() string {
+	return m.decimal() + " " + m.currency()
+}
+
+// decimal formats the amount in major units
+func (m Money) decimal() string {
+	exponent := currencyExponents[m.currency()]
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	if exponent == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+	padded := fmt.Sprintf("%0*d", exponent+1, amount)
+	return sign + padded[:len(padded)-exponent] + "." + padded[len(padded)-exponent:]
+}
+
+// moneyJSON is how Money appears in requests and responses. The amount is
+// a decimal string in major units so clients never deal with floats.
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.decimal(), Currency: m.currency()})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var value moneyJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("%w: expected {\"amount\": \"12.50\", \"currency\": \"MMK\"}", ErrInvalidAmount)
+	}
+	parsed, err := ParseMoney(value.Amount, value.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value, currency string
+		want            Money
+		err             error
+	}{
+		{"12.50", "MMK", Money{Amount: 1250, Currency: "MMK"}, nil},
+		{"12.5", "MMK", Money{Amount: 1250, Currency: "MMK"}, nil},
+		{"12", "MMK", Money{Amount: 1200, Currency: "MMK"}, nil},
+		{"0.01", "usd", Money{Amount: 1, Currency: "USD"}, nil},
+		{" 7.00 ", " eur ", Money{Amount: 700, Currency: "EUR"}, nil},
+		{"100", "", Money{Amount: 10000, Currency: DefaultCurrency}, nil},
+		{"1500", "JPY", Money{Amount: 1500, Currency: "JPY"}, nil},
+		{"0", "MMK", Money{Amount: 0, Currency: "MMK"}, nil},
+		{"12.505", "MMK", Money{}, ErrInvalidAmount},
+		{"1.5", "JPY", Money{}, ErrInvalidAmount},
+		{"-1.00", "MMK", Money{}, ErrInvalidAmount},
+		{"+1.00", "MMK", Money{}, ErrInvalidAmount},
+		{"1e3", "MMK", Money{}, ErrInvalidAmount},
+		{"1,000", "MMK", Money{}, ErrInvalidAmount},
+		{".50", "MMK", Money{}, ErrInvalidAmount},
+		{"12.", "MMK", Money{}, ErrInvalidAmount},
+		{"", "MMK", Money{}, ErrInvalidAmount},
+		{"99999999999999999999", "MMK", Money{}, ErrInvalidAmount},
+		{"1.00", "XYZ", Money{}, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.value, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseMoney(%q, %q) error = %v, want %v", tt.value, tt.currency, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q, %q) = %+v, want %+v", tt.value, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 1250, Currency: "MMK"}, "12.50 MMK"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05 USD"},
+		{Money{Amount: 0, Currency: "EUR"}, "0.00 EUR"},
+		{Money{Amount: -1250, Currency: "MMK"}, "-12.50 MMK"},
+		{Money{Amount: -5, Currency: "USD"}, "-0.05 USD"},
+		{Money{Amount: 1500, Currency: "JPY"}, "1500 JPY"},
+		{Money{Amount: 100}, "1.00 " + DefaultCurrency},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	mmk := func(amount int64) Money { return Money{Amount: amount, Currency: "MMK"} }
+
+	sum, err := mmk(1250).Add(mmk(75))
+	if err != nil || sum != mmk(1325) {
+		t.Errorf("Add = %+v, %v, want %+v", sum, err, mmk(1325))
+	}
+	difference, err := mmk(1000).Sub(mmk(1250))
+	if err != nil || difference != mmk(-250) || !difference.IsNegative() {
+		t.Errorf("Sub = %+v, %v, want %+v", difference, err, mmk(-250))
+	}
+	if product := mmk(333).Mul(3); product != mmk(999) {
+		t.Errorf("Mul = %+v, want %+v", product, mmk(999))
+	}
+	if _, err := mmk(100).Add(Money{Amount: 100, Currency: "USD"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := mmk(100).Sub(Money{Amount: 100, Currency: "USD"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub across currencies error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+
+	// An empty currency is the default one
+	if sum, err := (Money{Amount: 1}).Add(mmk(1)); err != nil || sum != mmk(2) {
+		t.Errorf("Add with default currency = %+v, %v, want %+v", sum, err, mmk(2))
+	}
+	if !(Money{Amount: 5}).Equal(mmk(5)) || mmk(5).Equal(Money{Amount: 5, Currency: "USD"}) {
+		t.Error("Equal must compare amounts and currencies, defaulting an empty currency")
+	}
+	if zero := (Money{Amount: 5, Currency: "USD"}).Zero(); zero != (Money{Currency: "USD"}) || !zero.IsZero() {
+		t.Errorf("Zero = %+v, want 0 USD", zero)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(Money{Amount: 1250, Currency: "MMK"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":"12.50","currency":"MMK"}` {
+		t.Errorf("Marshal = %s", data)
+	}
+
+	var money Money
+	if err := json.Unmarshal(data, &money); err != nil || money != (Money{Amount: 1250, Currency: "MMK"}) {
+		t.Errorf("Unmarshal = %+v, %v", money, err)
+	}
+	for _, input := range []string{`{"amount":12.5,"currency":"MMK"}`, `{"amount":"12.505","currency":"MMK"}`, `"12.50"`} {
+		if err := json.Unmarshal([]byte(input), &money); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Unmarshal(%s) error = %v, want %v", input, err, ErrInvalidAmount)
+		}
+	}
+}
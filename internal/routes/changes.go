@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"go_boilerplate/internal/audit"
+	"net/http"
+	"strconv"
+)
+
+// getEntityChanges lists the audit log, filtered by entity, entity_id,
+// actor, from and to
+func (rt *router) getEntityChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		EntityType: query.Get("entity"),
+		Actor:      query.Get("actor"),
+	}
+	if filter.EntityType != "" && !audit.Tracked[filter.EntityType] {
+		http.Error(w, "Unknown entity", http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("entity_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid entity_id", http.StatusBadRequest)
+			return
+		}
+		filter.EntityID = uint(id)
+	}
+	var err error
+	if filter.From, err = parseTimeParam(r, "from", false); err != nil {
+		http.Error(w, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTimeParam(r, "to", true); err != nil {
+		http.Error(w, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := audit.Changes(rt.requestDB(r), filter)
+	if err != nil {
+		http.Error(w, "Failed to retrieve changes", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   changes,
+		"status": "success",
+		"count":  len(changes),
+	})
+}
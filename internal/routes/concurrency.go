@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"errors"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// etag formats a row version as a strong entity tag
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// versionOf returns the Version field of a pointer to a model
+func versionOf(model interface{}) uint {
+	return uint(reflect.Indirect(reflect.ValueOf(model)).FieldByName("Version").Uint())
+}
+
+// ifMatch reads the row version a write is based on from the If-Match
+// header. Writes without one are refused with a 428, so a client cannot
+// overwrite changes it has not seen; ok is false when a response was
+// written.
+func ifMatch(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		http.Error(w, "If-Match must be a single ETag returned by this API", http.StatusBadRequest)
+		return 0, false
+	}
+	version, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		http.Error(w, "If-Match must be a single ETag returned by this API", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(version), true
+}
+
+// resolveImageURLs fills image URLs on the models that have them
+func (rt *router) resolveImageURLs(model interface{}) {
+	switch model := model.(type) {
+	case *models.Product:
+		rt.resolveImageURL(model)
+	case *models.ProductVariant:
+		rt.resolveVariantImageURL(model)
+	case *models.Repair:
+		rt.resolveRepairImageURLs(model)
+	}
+}
+
+// getVersioned answers a single row read of the row named by the id
+// parameter with the row and its ETag. query carries any scope the caller
+// is restricted to.
+func (rt *router) getVersioned(w http.ResponseWriter, r *http.Request, query *gorm.DB, model interface{}, name string) {
+	id, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	rt.writeVersioned(w, query, model, id, name)
+}
+
+// writeVersioned loads the row with the given id and answers with it and
+// its ETag
+func (rt *router) writeVersioned(w http.ResponseWriter, query *gorm.DB, model interface{}, id uint, name string) {
+	err := query.First(model, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, name+" not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve "+strings.ToLower(name), http.StatusInternalServerError)
+		return
+	}
+	rt.resolveImageURLs(model)
+
+	w.Header().Set("ETag", etag(versionOf(model)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   model,
+		"status": "success",
+	})
+}
+
+// preconditionFailed answers a write whose If-Match version is stale with
+// a 412 and the current row, so the client can merge and retry. A row that
+// no longer exists gets a 404 instead.
+func (rt *router) preconditionFailed(w http.ResponseWriter, r *http.Request, model interface{}, id uint, name string) {
+	err := rt.requestDB(r).First(model, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, name+" not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve "+strings.ToLower(name), http.StatusInternalServerError)
+		return
+	}
+	rt.resolveImageURLs(model)
+
+	w.Header().Set("ETag", etag(versionOf(model)))
+	writeJSON(w, http.StatusPreconditionFailed, map[string]interface{}{
+		"message": name + " was changed by someone else",
+		"status":  "error",
+		"data":    model,
+	})
+}
+
+func (rt *router) getBrandByID(w http.ResponseWriter, r *http.Request) {
+	rt.getVersioned(w, r, rt.requestDB(r), &models.Brand{}, "Brand")
+}
+
+func (rt *router) getCategoryByID(w http.ResponseWriter, r *http.Request) {
+	rt.getVersioned(w, r, rt.requestDB(r), &models.Category{}, "Category")
+}
+
+func (rt *router) getProductByID(w http.ResponseWriter, r *http.Request) {
+	query := rt.requestDB(r).Preload("Brand", unscoped).Preload("Category", unscoped).
+		Preload("Images", byPosition).Preload("Variants", orderByID)
+	rt.getVersioned(w, r, query, &models.Product{}, "Product")
+}
+
+func (rt *router) getOrderByID(w http.ResponseWriter, r *http.Request) {
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		query = query.Where("user_id = ?", userID)
+	}
+	rt.getVersioned(w, r, query, &models.Order{}, "Order")
+}
+
+func (rt *router) getPaymentByID(w http.ResponseWriter, r *http.Request) {
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		query = query.Joins("JOIN orders ON orders.id = payments.order_id AND orders.deleted_at IS NULL").
+			Where("orders.user_id = ?", userID)
+	}
+	rt.getVersioned(w, r, query, &models.Payment{}, "Payment")
+}
+
+func (rt *router) getShippingByID(w http.ResponseWriter, r *http.Request) {
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		query = query.Joins("JOIN orders ON orders.id = shippings.order_id AND orders.deleted_at IS NULL").
+			Where("orders.user_id = ?", userID)
+	}
+	rt.getVersioned(w, r, query, &models.Shipping{}, "Shipping")
+}
+
+func (rt *router) getRepairByID(w http.ResponseWriter, r *http.Request) {
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageRepairs); scoped {
+		query = query.Where("user_id = ?", userID)
+	}
+	rt.getVersioned(w, r, query.Preload("Images", orderByID), &models.Repair{}, "Repair")
+}
+
+func (rt *router) getRepairStatusByID(w http.ResponseWriter, r *http.Request) {
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageRepairs); scoped {
+		query = query.Joins("JOIN repairs ON repairs.id = repair_statuses.repair_id").
+			Where("repairs.user_id = ?", userID)
+	}
+	rt.getVersioned(w, r, query, &models.RepairStatus{}, "Repair status")
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"encoding/json"
+	"go_boilerplate/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		version uint
+		ok      bool
+		status  int
+	}{
+		{`"3"`, 3, true, http.StatusOK},
+		{` "12" `, 12, true, http.StatusOK},
+		{"", 0, false, http.StatusPreconditionRequired},
+		{"   ", 0, false, http.StatusPreconditionRequired},
+		{"3", 0, false, http.StatusBadRequest},
+		{`W/"3"`, 0, false, http.StatusBadRequest},
+		{`"abc"`, 0, false, http.StatusBadRequest},
+		{`"-1"`, 0, false, http.StatusBadRequest},
+		{`""`, 0, false, http.StatusBadRequest},
+		{`"`, 0, false, http.StatusBadRequest},
+		{`"1", "2"`, 0, false, http.StatusBadRequest},
+		{"*", 0, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("If-Match", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		version, ok := ifMatch(rec, req)
+		if version != tt.version || ok != tt.ok || rec.Code != tt.status {
+			t.Errorf("If-Match %q = %d, %v with %d, want %d, %v with %d", tt.header, version, ok, rec.Code, tt.version, tt.ok, tt.status)
+		}
+	}
+
+	if got := etag(7); got != `"7"` {
+		t.Errorf(`etag(7) = %s, want "7"`, got)
+	}
+}
+
+func TestVersionedUpdate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Brand{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Brand{Name: "acme"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := newBareRouter()
+	r.db = db
+	r.AddRoute(http.MethodGet, "/brands/:id", r.getBrandByID)
+	r.AddRoute(http.MethodPut, "/brands/:id", r.updateBrand)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		ifMatch string
+		body    string
+		status  int
+		etag    string
+		brand   string
+	}{
+		{"read", http.MethodGet, "/brands/1", "", "", http.StatusOK, `"1"`, "acme"},
+		{"write without If-Match", http.MethodPut, "/brands/1", "", `{"name":"lost"}`, http.StatusPreconditionRequired, "", ""},
+		{"write of the read version", http.MethodPut, "/brands/1", `"1"`, `{"name":"acme inc"}`, http.StatusOK, `"2"`, ""},
+		// The stale write gets the current row to merge with
+		{"write of a stale version", http.MethodPut, "/brands/1", `"1"`, `{"name":"lost"}`, http.StatusPreconditionFailed, `"2"`, "acme inc"},
+		{"write of a missing row", http.MethodPut, "/brands/9", `"1"`, `{"name":"lost"}`, http.StatusNotFound, "", ""},
+		{"read after the writes", http.MethodGet, "/brands/1", "", "", http.StatusOK, `"2"`, "acme inc"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+			continue
+		}
+		if etag := rec.Header().Get("ETag"); etag != tt.etag {
+			t.Errorf("%s: ETag = %s, want %s", tt.name, etag, tt.etag)
+		}
+		if tt.brand == "" {
+			continue
+		}
+		var response struct{ Data models.Brand }
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || response.Data.Name != tt.brand {
+			t.Errorf("%s: body = %s, want brand %q", tt.name, rec.Body, tt.brand)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"go_boilerplate/internal/services"
+	"go_boilerplate/pkg"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errUploadTargetGone = errors.New("upload target no longer exists")
+
+type directUploadRequest struct {
+	Target      string `json:"target"`
+	TargetID    uint   `json:"targetId"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// directUploadResponse tells the client where and how to send the file.
+// The headers must be sent exactly as given, they are part of the
+// signature.
+type directUploadResponse struct {
+	ID        uint              `json:"id"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+type completeUploadRequest struct {
+	AltText string `json:"altText"`
+	Primary bool   `json:"primary"`
+}
+
+// repairImagePrefix is the storage prefix of a repair's images
+func repairImagePrefix(repairID uint) string {
+	return fmt.Sprintf("repairs/%d", repairID)
+}
+
+// authorizeUploadTarget checks that the target exists and that the caller
+// may attach files to it: catalog managers to products, repair managers
+// and the repair's owner to repairs. ok is false when a response was
+// written.
+func (rt *router) authorizeUploadTarget(w http.ResponseWriter, r *http.Request, target string, targetID uint) bool {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	var query *gorm.DB
+	var name string
+	switch target {
+	case models.UploadTargetProduct:
+		if !principal.Can(middleware.PermManageCatalog) {
+			http.Error(w, "Insufficient permissions", http.StatusForbidden)
+			return false
+		}
+		query, name = rt.requestDB(r).Model(&models.Product{}), "Product"
+	case models.UploadTargetRepair:
+		if !principal.Can(middleware.PermManageRepairs) && !principal.Can(middleware.PermRequestRepairs) {
+			http.Error(w, "Insufficient permissions", http.StatusForbidden)
+			return false
+		}
+		query, name = rt.requestDB(r).Model(&models.Repair{}), "Repair"
+		if userID, scoped := ownerScope(r, middleware.PermManageRepairs); scoped {
+			query = query.Where("user_id = ?", userID)
+		}
+	default:
+		http.Error(w, "Target must be product or repair", http.StatusBadRequest)
+		return false
+	}
+
+	var count int64
+	if err := query.Where("id = ?", targetID).Count(&count).Error; err != nil {
+		http.Error(w, "Failed to retrieve "+target, http.StatusInternalServerError)
+		return false
+	}
+	if count == 0 {
+		http.Error(w, name+" not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// writeDirectUploadError reports an error from starting or completing a
+// direct upload
+func writeDirectUploadError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrDirectUploadsUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, services.ErrUploadNotFound):
+		http.Error(w, "Upload not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrUploadExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, services.ErrUploadMissing), errors.Is(err, pkg.ErrObjectNotFound):
+		http.Error(w, services.ErrUploadMissing.Error(), http.StatusConflict)
+	case errors.Is(err, errUploadTargetGone):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, pkg.ErrImageTooLarge), errors.Is(err, pkg.ErrNotAnImage):
+		writeUploadError(w, err)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+// startDirectUpload issues a presigned URL the client uploads one image to
+// without going through the API. The content type and size are fixed by
+// the signature; the file is validated when the upload is completed.
+func (rt *router) startDirectUpload(w http.ResponseWriter, r *http.Request) {
+	var input directUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !pkg.AcceptsImageType(input.ContentType) {
+		http.Error(w, pkg.ErrNotAnImage.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if input.Size <= 0 {
+		http.Error(w, "Size must be positive", http.StatusBadRequest)
+		return
+	}
+	if input.Size > int64(rt.config.Images.MaxBytes) {
+		http.Error(w, fmt.Sprintf("%s: larger than %d bytes", pkg.ErrImageTooLarge, rt.config.Images.MaxBytes),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !rt.authorizeUploadTarget(w, r, input.Target, input.TargetID) {
+		return
+	}
+
+	upload, url, err := rt.uploads.Begin(r.Context(), models.PendingUpload{
+		TargetType:  input.Target,
+		TargetID:    input.TargetID,
+		FileName:    pkg.SanitizeFileName(input.FileName),
+		ContentType: input.ContentType,
+		Size:        input.Size,
+		CreatedBy:   actor(r),
+	})
+	if err != nil {
+		writeDirectUploadError(w, err, "Failed to start upload")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Upload started successfully",
+		"status":  "success",
+		"data": directUploadResponse{
+			ID:        upload.ID,
+			URL:       url,
+			Method:    http.MethodPut,
+			Headers:   map[string]string{"Content-Type": upload.ContentType},
+			ExpiresAt: upload.ExpiresAt,
+		},
+	})
+}
+
+// completeDirectUpload validates the file the client uploaded, processes
+// it like a multipart upload and attaches it to the upload's target
+func (rt *router) completeDirectUpload(w http.ResponseWriter, r *http.Request) {
+	uploadID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	var input completeUploadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pending, err := rt.uploads.Claim(r.Context(), uploadID, actor(r))
+	if err != nil {
+		writeDirectUploadError(w, err, "Failed to complete upload")
+		return
+	}
+	if !rt.authorizeUploadTarget(w, r, pending.TargetType, pending.TargetID) {
+		return
+	}
+	// A product image changes the product, so it needs the product's ETag
+	// like addProductImages does
+	var version uint
+	if pending.TargetType == models.UploadTargetProduct {
+		if version, ok = ifMatch(w, r); !ok {
+			return
+		}
+		var product models.Product
+		err := rt.requestDB(r).Select("id", "version").First(&product, pending.TargetID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeDirectUploadError(w, errUploadTargetGone, "Failed to complete upload")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to complete upload", http.StatusInternalServerError)
+			return
+		}
+		if product.Version != version {
+			rt.preconditionFailed(w, r, &models.Product{}, pending.TargetID, "Product")
+			return
+		}
+	}
+
+	var renditions []pkg.RenditionSpec
+	if pending.TargetType == models.UploadTargetProduct {
+		renditions = rt.renditionSpecs()
+	}
+	body, err := rt.storage.Open(r.Context(), pending.ObjectKey)
+	if err != nil {
+		writeDirectUploadError(w, err, "Failed to read upload")
+		return
+	}
+	upload, err := rt.processImage(body, pending.FileName, renditions)
+	body.Close()
+	if err != nil {
+		writeDirectUploadError(w, err, "Failed to process upload")
+		return
+	}
+	upload.altText = input.AltText
+
+	switch pending.TargetType {
+	case models.UploadTargetProduct:
+		rt.completeProductUpload(w, r, pending, upload, version, input.Primary)
+	case models.UploadTargetRepair:
+		rt.completeRepairUpload(w, r, pending, upload)
+	}
+}
+
+func (rt *router) completeProductUpload(w http.ResponseWriter, r *http.Request, pending *models.PendingUpload, upload imageUpload, version uint, primary bool) {
+	productID := pending.TargetID
+	uploads := []imageUpload{upload}
+
+	err := rt.uploads.Complete(r.Context(), pending, func(tx *gorm.DB) error {
+		var product models.Product
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").First(&product, productID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errUploadTargetGone
+		}
+		if err != nil {
+			return err
+		}
+		if err := bumpProductVersion(tx, productID, version); err != nil {
+			return err
+		}
+		if err := rt.storeUploads(r, productImagePrefix(productID), uploads); err != nil {
+			return err
+		}
+		_, err = attachImages(tx, productID, uploads, primary)
+		return err
+	})
+	if err != nil {
+		rt.discardUploads(r, uploads)
+		if errors.Is(err, errStaleProduct) {
+			rt.preconditionFailed(w, r, &models.Product{}, productID, "Product")
+		} else {
+			writeDirectUploadError(w, err, "Failed to add product image")
+		}
+		return
+	}
+
+	rt.writeImages(w, r, http.StatusCreated, productID, version+1, "Product image added successfully")
+}
+
+func (rt *router) completeRepairUpload(w http.ResponseWriter, r *http.Request, pending *models.PendingUpload, upload imageUpload) {
+	var image models.RepairImage
+	err := rt.uploads.Complete(r.Context(), pending, func(tx *gorm.DB) error {
+		// Holding the repair keeps deleteRepair from removing it, and the
+		// images it collects, while this image is attached
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").First(&models.Repair{}, pending.TargetID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errUploadTargetGone
+		}
+		if err != nil {
+			return err
+		}
+		if err := rt.storeUpload(r, repairImagePrefix(pending.TargetID), &upload); err != nil {
+			return err
+		}
+		image = models.RepairImage{
+			RepairID:     pending.TargetID,
+			ImageKey:     upload.image.ImageKey,
+			OriginalName: upload.image.OriginalName,
+			ContentType:  upload.image.ContentType,
+			Width:        upload.image.Width,
+			Height:       upload.image.Height,
+		}
+		return tx.Create(&image).Error
+	})
+	if err != nil {
+		rt.discardUploads(r, []imageUpload{upload})
+		writeDirectUploadError(w, err, "Failed to add repair image")
+		return
+	}
+	image.ImageURL = rt.storage.URL(image.ImageKey)
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Repair image added successfully",
+		"status":  "success",
+		"data":    image,
+	})
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"go_boilerplate/internal/middleware"
+	"net/http"
+	"strings"
+)
+
+// group registers routes under a shared path prefix and middleware chain.
+// Middleware is composed once when a route is registered, not per request.
+type group struct {
+	router      *router
+	prefix      string
+	middlewares []middleware.MiddlewareFunc
+}
+
+// Use appends middlewares to the group. It only affects routes registered
+// afterwards, so call it before adding routes or nested groups.
+func (g *group) Use(middlewares ...middleware.MiddlewareFunc) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// Group creates a nested group that inherits this group's prefix and middlewares
+func (g *group) Group(prefix string, middlewares ...middleware.MiddlewareFunc) *group {
+	chain := make([]middleware.MiddlewareFunc, 0, len(g.middlewares)+len(middlewares))
+	chain = append(chain, g.middlewares...)
+	chain = append(chain, middlewares...)
+	return &group{
+		router:      g.router,
+		prefix:      joinPath(g.prefix, prefix),
+		middlewares: chain,
+	}
+}
+
+// AddRoute registers handler for method and path relative to the group prefix,
+// wrapped in the group's middleware chain
+func (g *group) AddRoute(method, path string, handler http.HandlerFunc) {
+	chain := middleware.SetHandler(handler).Chain(g.middlewares...)
+	g.router.root.insert(method, joinPath(g.prefix, path), chain.ServeHTTP)
+}
+
+// joinPath concatenates two route paths with exactly one slash between them
+func joinPath(prefix, path string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	path = strings.TrimLeft(path, "/")
+	if path == "" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	return prefix + "/" + path
+}
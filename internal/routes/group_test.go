@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"go_boilerplate/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tag returns a middleware that appends name to the X-Chain header
+func tag(name string) middleware.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Chain", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	r := newBareRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Chain", "handler")
+	}
+	r.Use(tag("global"))
+	r.AddRoute(http.MethodGet, "/health", handler)
+	admin := r.Group("/admin", tag("auth"))
+	admin.Use(tag("admin"))
+	admin.AddRoute(http.MethodGet, "/", handler)
+	admin.AddRoute(http.MethodGet, "products/:id", handler)
+	reports := admin.Group("/reports/", tag("reports"))
+	reports.AddRoute(http.MethodGet, "/sales", handler)
+	// Middleware added to the parent later does not reach routes already
+	// registered, nor groups created before it
+	admin.Use(tag("late"))
+	admin.AddRoute(http.MethodGet, "/late", handler)
+
+	tests := []struct {
+		path  string
+		chain string
+	}{
+		{"/health", "global,handler"},
+		{"/admin", "global,auth,admin,handler"},
+		{"/admin/products/3", "global,auth,admin,handler"},
+		{"/admin/reports/sales", "global,auth,admin,reports,handler"},
+		{"/admin/late", "global,auth,admin,late,handler"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", tt.path, rec.Code, http.StatusOK)
+			continue
+		}
+		if chain := strings.Join(rec.Header().Values("X-Chain"), ","); chain != tt.chain {
+			t.Errorf("%s: ran %s, want %s", tt.path, chain, tt.chain)
+		}
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		prefix, path, want string
+	}{
+		{"", "", "/"},
+		{"", "/", "/"},
+		{"/", "/products", "/products"},
+		{"/admin", "", "/admin"},
+		{"/admin/", "/", "/admin"},
+		{"/admin", "products", "/admin/products"},
+		{"/admin/", "/products/:id", "/admin/products/:id"},
+	}
+	for _, tt := range tests {
+		if got := joinPath(tt.prefix, tt.path); got != tt.want {
+			t.Errorf("joinPath(%q, %q) = %q, want %q", tt.prefix, tt.path, got, tt.want)
+		}
+	}
+}
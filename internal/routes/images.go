@@ -0,0 +1,554 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+	"go_boilerplate/pkg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errImageNotFound = errors.New("product image not found")
+	errStaleProduct  = errors.New("product was changed")
+)
+
+// imageUpload is a processed upload. Once stored, image holds its object
+// keys and stored lists the objects the upload added, which are the ones
+// to remove again if it is never attached.
+type imageUpload struct {
+	processed *pkg.ProcessedImage
+	altText   string
+	image     models.ProductImage
+	stored    []string
+}
+
+type imageRequest struct {
+	AltText *string `json:"altText"`
+	Primary bool    `json:"primary"`
+}
+
+type imageOrderRequest struct {
+	ImageIDs []uint `json:"imageIds"`
+}
+
+// byPosition is a preload condition that keeps images in display order
+func byPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+// renditionSpecs lists the scaled copies made of every product image
+func (rt *router) renditionSpecs() []pkg.RenditionSpec {
+	return []pkg.RenditionSpec{
+		{Name: "thumbnail", Width: rt.config.Images.ThumbnailWidth},
+		{Name: "medium", Width: rt.config.Images.MediumWidth},
+		{Name: "large", Width: rt.config.Images.LargeWidth},
+	}
+}
+
+// productImagePrefix is the storage prefix of a product's images
+func productImagePrefix(productID uint) string {
+	return fmt.Sprintf("products/%d", productID)
+}
+
+// variantImagePrefix is the storage prefix of the images of a product's
+// variants
+func variantImagePrefix(productID uint) string {
+	return fmt.Sprintf("products/%d/variants", productID)
+}
+
+// processUpload validates and processes one uploaded file. Nothing is
+// stored until storeUpload is called.
+func (rt *router) processUpload(header *multipart.FileHeader, renditions []pkg.RenditionSpec) (imageUpload, error) {
+	file, err := header.Open()
+	if err != nil {
+		return imageUpload{}, err
+	}
+	defer file.Close()
+	return rt.processImage(file, header.Filename, renditions)
+}
+
+// processImage validates and processes an image read from body. fileName
+// is the name the client gave the file.
+func (rt *router) processImage(body io.Reader, fileName string, renditions []pkg.RenditionSpec) (imageUpload, error) {
+	limits := pkg.ImageLimits{
+		MaxBytes:  int64(rt.config.Images.MaxBytes),
+		MaxWidth:  rt.config.Images.MaxWidth,
+		MaxHeight: rt.config.Images.MaxHeight,
+	}
+	processed, err := pkg.ProcessImage(body, limits, renditions)
+	if err != nil {
+		return imageUpload{}, err
+	}
+
+	return imageUpload{
+		processed: processed,
+		image: models.ProductImage{
+			OriginalName: pkg.SanitizeFileName(fileName),
+			ContentType:  processed.Original.ContentType,
+			Width:        processed.Original.Width,
+			Height:       processed.Original.Height,
+		},
+	}, nil
+}
+
+// storeUpload saves the original and renditions of an upload under prefix,
+// keyed by their content. Objects that are already stored are not sent
+// again, so uploading the same file twice stores it once.
+func (rt *router) storeUpload(r *http.Request, prefix string, upload *imageUpload) error {
+	processed := upload.processed
+	upload.image.ImageKey = pkg.ContentKey(prefix, processed.Original.Data, processed.Original.Extension)
+	upload.image.Renditions = make(models.ImageRenditions, len(processed.Renditions))
+	for name, rendition := range processed.Renditions {
+		upload.image.Renditions[name] = models.ImageRendition{
+			Key:    pkg.ContentKey(prefix, rendition.Data, rendition.Extension),
+			Width:  rendition.Width,
+			Height: rendition.Height,
+		}
+	}
+
+	put := func(key string, encoded pkg.EncodedImage) error {
+		exists, err := rt.storage.Exists(r.Context(), key)
+		if err != nil || exists {
+			return err
+		}
+		if err := rt.storage.Put(r.Context(), key, bytes.NewReader(encoded.Data), encoded.ContentType); err != nil {
+			return err
+		}
+		upload.stored = append(upload.stored, key)
+		return nil
+	}
+	if err := put(upload.image.ImageKey, processed.Original); err != nil {
+		rt.discardUploads(r, []imageUpload{*upload})
+		return err
+	}
+	for name, rendition := range processed.Renditions {
+		if err := put(upload.image.Renditions[name].Key, rendition); err != nil {
+			rt.discardUploads(r, []imageUpload{*upload})
+			return err
+		}
+	}
+	return nil
+}
+
+// storeUploads stores every upload under prefix, or none of them
+func (rt *router) storeUploads(r *http.Request, prefix string, uploads []imageUpload) error {
+	for i := range uploads {
+		if err := rt.storeUpload(r, prefix, &uploads[i]); err != nil {
+			rt.discardUploads(r, uploads[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// discardUploads removes the objects stored for uploads that never made it
+// into the database. Objects that were already there are left alone.
+func (rt *router) discardUploads(r *http.Request, uploads []imageUpload) {
+	for _, upload := range uploads {
+		for _, key := range upload.stored {
+			rt.storage.Delete(r.Context(), key)
+		}
+	}
+}
+
+// writeUploadError reports why an upload was refused
+func writeUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pkg.ErrImageTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, pkg.ErrNotAnImage):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	default:
+		http.Error(w, "Unable to store image", http.StatusInternalServerError)
+	}
+}
+
+// readImages processes every file sent in the image field, each with the
+// alt text sent at the same index in the alt field. Sending no file is not
+// an error. ok is false when a response was written.
+func (rt *router) readImages(w http.ResponseWriter, r *http.Request) ([]imageUpload, bool) {
+	if r.MultipartForm == nil {
+		return nil, true
+	}
+	files := r.MultipartForm.File["image"]
+	alts := r.MultipartForm.Value["alt"]
+
+	uploads := make([]imageUpload, 0, len(files))
+	for i, header := range files {
+		upload, err := rt.processUpload(header, rt.renditionSpecs())
+		if err != nil {
+			writeUploadError(w, fmt.Errorf("%s: %w", pkg.SanitizeFileName(header.Filename), err))
+			return nil, false
+		}
+		if i < len(alts) {
+			upload.altText = alts[i]
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, true
+}
+
+// attachImages appends images after the product's current last image. The
+// first new image becomes the primary one when primary is set or the
+// product has no primary image yet. Uploads identical to an image the
+// product already has are skipped.
+func attachImages(tx *gorm.DB, productID uint, uploads []imageUpload, primary bool) ([]models.ProductImage, error) {
+	var keys []string
+	if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).
+		Pluck("image_key", &keys).Error; err != nil {
+		return nil, err
+	}
+	images := make([]models.ProductImage, 0, len(uploads))
+	for _, upload := range uploads {
+		if slices.Contains(keys, upload.image.ImageKey) {
+			continue
+		}
+		keys = append(keys, upload.image.ImageKey)
+		image := upload.image
+		image.AltText = upload.altText
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return nil, nil
+	}
+
+	var last int
+	if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).
+		Select("COALESCE(MAX(position), -1)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+	var primaries int64
+	if err := tx.Model(&models.ProductImage{}).Where("product_id = ? AND is_primary", productID).
+		Count(&primaries).Error; err != nil {
+		return nil, err
+	}
+	if primary && primaries > 0 {
+		if err := clearPrimary(tx, productID); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range images {
+		images[i].ProductID = productID
+		images[i].Position = last + 1 + i
+		images[i].IsPrimary = i == 0 && (primary || primaries == 0)
+	}
+	return images, tx.Create(&images).Error
+}
+
+// clearPrimary unsets the product's primary image so another can take it
+func clearPrimary(tx *gorm.DB, productID uint) error {
+	return tx.Model(&models.ProductImage{}).Where("product_id = ? AND is_primary", productID).
+		Update("is_primary", false).Error
+}
+
+// bumpProductVersion moves the product past version, failing with
+// errStaleProduct when someone else changed it first. Image changes are
+// changes to the product, so they share its ETag.
+func bumpProductVersion(tx *gorm.DB, productID, version uint) error {
+	result := tx.Model(&models.Product{}).Where("id = ? AND version = ?", productID, version).
+		Update("version", version+1)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errStaleProduct
+	}
+	return nil
+}
+
+// findImage loads one of the product's images
+func findImage(tx *gorm.DB, productID, imageID uint) (models.ProductImage, error) {
+	var image models.ProductImage
+	err := tx.Where("product_id = ?", productID).First(&image, imageID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return image, errImageNotFound
+	}
+	return image, err
+}
+
+// writeImageError reports an error from an image change of the product
+func (rt *router) writeImageError(w http.ResponseWriter, r *http.Request, err error, productID uint, fallback string) {
+	switch {
+	case errors.Is(err, errStaleProduct):
+		rt.preconditionFailed(w, r, &models.Product{}, productID, "Product")
+	case errors.Is(err, errImageNotFound):
+		http.Error(w, "Product image not found", http.StatusNotFound)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+// writeImages answers with the product's images in display order and the
+// product's new ETag
+func (rt *router) writeImages(w http.ResponseWriter, r *http.Request, status int, productID, version uint, message string) {
+	var images []models.ProductImage
+	if err := byPosition(rt.requestDB(r)).Where("product_id = ?", productID).Find(&images).Error; err != nil {
+		http.Error(w, "Failed to retrieve product images", http.StatusInternalServerError)
+		return
+	}
+	for i := range images {
+		rt.resolveProductImageURL(&images[i])
+	}
+
+	w.Header().Set("ETag", etag(version))
+	writeJSON(w, status, map[string]interface{}{
+		"message": message,
+		"status":  "success",
+		"data":    images,
+		"count":   len(images),
+	})
+}
+
+// addProductImages stores one or more files sent in the image field and
+// appends them to the product's images. Like the other image changes it
+// needs the product's ETag in If-Match.
+func (rt *router) addProductImages(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(10 << 20)
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	primary := false
+	if value := r.FormValue("primary"); value != "" {
+		var err error
+		if primary, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid primary flag", http.StatusBadRequest)
+			return
+		}
+	}
+	var product models.Product
+	if err := rt.requestDB(r).Select("id", "version").First(&product, productID).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if product.Version != version {
+		rt.preconditionFailed(w, r, &models.Product{}, productID, "Product")
+		return
+	}
+
+	uploads, ok := rt.readImages(w, r)
+	if !ok {
+		return
+	}
+	if len(uploads) == 0 {
+		http.Error(w, "At least one image is required", http.StatusBadRequest)
+		return
+	}
+	if err := rt.storeUploads(r, productImagePrefix(productID), uploads); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	err := rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := bumpProductVersion(tx, productID, version); err != nil {
+			return err
+		}
+		_, err := attachImages(tx, productID, uploads, primary)
+		return err
+	})
+	if err != nil {
+		rt.discardUploads(r, uploads)
+		rt.writeImageError(w, r, err, productID, "Failed to add product images")
+		return
+	}
+
+	rt.writeImages(w, r, http.StatusCreated, productID, version+1, "Product images added successfully")
+}
+
+// updateProductImage changes an image's alt text or makes it the primary
+// image. The primary flag can only be moved, not cleared.
+func (rt *router) updateProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := IntParam(w, r, "imageId")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	var input imageRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := bumpProductVersion(tx, productID, version); err != nil {
+			return err
+		}
+		image, err := findImage(tx, productID, imageID)
+		if err != nil {
+			return err
+		}
+		if input.AltText != nil {
+			if err := tx.Model(&image).Update("alt_text", *input.AltText).Error; err != nil {
+				return err
+			}
+		}
+		if input.Primary && !image.IsPrimary {
+			if err := clearPrimary(tx, productID); err != nil {
+				return err
+			}
+			return tx.Model(&image).Update("is_primary", true).Error
+		}
+		return nil
+	})
+	if err != nil {
+		rt.writeImageError(w, r, err, productID, "Failed to update product image")
+		return
+	}
+
+	rt.writeImages(w, r, http.StatusOK, productID, version+1, "Product image updated successfully")
+}
+
+// reorderProductImages sets the display order of the product's images. The
+// request lists every image id once, in the new order.
+func (rt *router) reorderProductImages(w http.ResponseWriter, r *http.Request) {
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	var input imageOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	errIncomplete := errors.New("imageIds must list every image of the product exactly once")
+	err := rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := bumpProductVersion(tx, productID, version); err != nil {
+			return err
+		}
+		var imageIDs []uint
+		if err := tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).
+			Pluck("id", &imageIDs).Error; err != nil {
+			return err
+		}
+		requested := slices.Clone(input.ImageIDs)
+		slices.Sort(requested)
+		slices.Sort(imageIDs)
+		if !slices.Equal(requested, imageIDs) {
+			return errIncomplete
+		}
+		for position, imageID := range input.ImageIDs {
+			if err := tx.Model(&models.ProductImage{}).Where("id = ?", imageID).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errIncomplete) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		rt.writeImageError(w, r, err, productID, "Failed to reorder product images")
+		return
+	}
+
+	rt.writeImages(w, r, http.StatusOK, productID, version+1, "Product images reordered successfully")
+}
+
+// unusedImageKeys returns the objects of a deleted product image that the
+// product's other images do not use. Keys follow content, so two images of
+// the product may share objects; variant images live under a prefix of
+// their own and never do.
+func unusedImageKeys(tx *gorm.DB, image models.ProductImage) ([]string, error) {
+	keys := image.ObjectKeys()
+	var inUse []string
+	var others []models.ProductImage
+	if err := tx.Select("image_key", "renditions").
+		Where("product_id = ?", image.ProductID).Find(&others).Error; err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		inUse = append(inUse, other.ObjectKeys()...)
+	}
+	return slices.DeleteFunc(keys, func(key string) bool {
+		return slices.Contains(inUse, key)
+	}), nil
+}
+
+// deleteProductImage removes an image and the stored files nothing else
+// uses. When the primary image goes, the next image in order takes its
+// place.
+func (rt *router) deleteProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	imageID, ok := IntParam(w, r, "imageId")
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var unused []string
+	err := rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := bumpProductVersion(tx, productID, version); err != nil {
+			return err
+		}
+		image, err := findImage(tx, productID, imageID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+		if unused, err = unusedImageKeys(tx, image); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ProductImage{}).
+			Where("product_id = ? AND position > ?", productID, image.Position).
+			Update("position", gorm.Expr("position - 1")).Error; err != nil {
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+		var next models.ProductImage
+		err = byPosition(tx).Where("product_id = ?", productID).First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&next).Update("is_primary", true).Error
+	})
+	if err != nil {
+		rt.writeImageError(w, r, err, productID, "Failed to delete product image")
+		return
+	}
+	for _, key := range unused {
+		rt.storage.Delete(r.Context(), key)
+	}
+
+	rt.writeImages(w, r, http.StatusOK, productID, version+1, "Product image deleted successfully")
+}
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"go_boilerplate/internal/services"
+	"net/http"
+	"time"
+)
+
+type movementRequest struct {
+	Kind      string `json:"kind"`
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+	VariantID *uint  `json:"variantId"`
+	OrderID   *uint  `json:"orderId"`
+	RepairID  *uint  `json:"repairId"`
+}
+
+// writeInventoryError reports an inventory service error. Known errors are
+// safe to show to the client; anything else becomes a generic 500.
+func writeInventoryError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMovement),
+		errors.Is(err, services.ErrVariantRequired):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrProductNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrVariantNotFound):
+		http.Error(w, "Product variant not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrStockBelowReserved),
+		errors.Is(err, services.ErrDuplicateSKU),
+		errors.Is(err, services.ErrUnallocatedStock):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+// parseTimeParam reads an RFC 3339 time or a date from the query. A date
+// used as an end is moved to the following midnight so the whole day is
+// included.
+func parseTimeParam(r *http.Request, name string, end bool) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return parsed, nil
+}
+
+func (rt *router) getStockMovements(w http.ResponseWriter, r *http.Request) {
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	from, err := parseTimeParam(r, "from", false)
+	if err != nil {
+		http.Error(w, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r, "to", true)
+	if err != nil {
+		http.Error(w, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+
+	movements, err := rt.inventory.WithContext(r.Context()).Movements(productID, from, to)
+	if err != nil {
+		http.Error(w, "Failed to retrieve stock movements", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   movements,
+		"status": "success",
+		"count":  len(movements),
+	})
+}
+
+func (rt *router) inputStockMovement(w http.ResponseWriter, r *http.Request) {
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	var input movementRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if !principal.Can(middleware.PermManageCatalog) && input.Kind != models.MovementRepairPart {
+		http.Error(w, "Only repair part movements are allowed", http.StatusForbidden)
+		return
+	}
+
+	movement, err := rt.inventory.WithContext(r.Context()).Record(models.StockMovement{
+		ProductID: productID,
+		VariantID: input.VariantID,
+		Kind:      input.Kind,
+		Quantity:  input.Quantity,
+		Reason:    input.Reason,
+		Actor:     actor(r),
+		OrderID:   input.OrderID,
+		RepairID:  input.RepairID,
+	})
+	if err != nil {
+		writeInventoryError(w, err, "Failed to record stock movement")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Stock movement recorded successfully",
+		"status":  "success",
+		"data":    movement,
+	})
+}
+
+func (rt *router) getStockReconciliation(w http.ResponseWriter, r *http.Request) {
+	discrepancies, err := rt.inventory.WithContext(r.Context()).Reconcile(false)
+	if err != nil {
+		http.Error(w, "Failed to reconcile stock", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   discrepancies,
+		"status": "success",
+		"count":  len(discrepancies),
+	})
+}
+
+// reconcileStock resets every mismatched product's stock to its ledger
+func (rt *router) reconcileStock(w http.ResponseWriter, r *http.Request) {
+	discrepancies, err := rt.inventory.WithContext(r.Context()).Reconcile(true)
+	if err != nil {
+		http.Error(w, "Failed to reconcile stock", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Stock reconciled with the ledger",
+		"status":  "success",
+		"data":    discrepancies,
+		"count":   len(discrepancies),
+	})
+}
@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"go_boilerplate/internal/services"
+	"io"
+	"net/http"
+)
+
+// writeOrderError reports an order service error. Known errors are safe to
+// show to the client; anything else becomes a generic 500.
+func writeOrderError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrEmptyCart),
+		errors.Is(err, services.ErrInvalidQuantity),
+		errors.Is(err, services.ErrAddressRequired),
+		errors.Is(err, services.ErrPaymentTypeRequired),
+		errors.Is(err, services.ErrInvalidDiscount),
+		errors.Is(err, services.ErrPaymentMismatch),
+		errors.Is(err, services.ErrPaymentMoved),
+		errors.Is(err, models.ErrCurrencyMismatch),
+		errors.Is(err, services.ErrVariantRequired),
+		errors.Is(err, services.ErrInvalidOrderStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrOrderNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrOrderLineNotFound):
+		http.Error(w, "Product order not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrPaymentNotFound):
+		http.Error(w, "Payment not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrProductNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrVariantNotFound):
+		http.Error(w, "Product variant not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrIllegalTransition),
+		errors.Is(err, services.ErrOrderNotPending),
+		errors.Is(err, services.ErrAlreadyPaid),
+		errors.Is(err, services.ErrInsufficientStock):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+type checkoutRequest struct {
+	UserID      uint                    `json:"userId"`
+	Items       []services.CheckoutItem `json:"items"`
+	Address     string                  `json:"address"`
+	PaymentType string                  `json:"paymentType"`
+}
+
+type transitionRequest struct {
+	Note string `json:"note"`
+}
+
+// transitionOrder returns a handler that moves the order named by the id
+// parameter to status. Illegal moves are rejected with 409.
+func (rt *router) transitionOrder(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderID, ok := IntParam(w, r, "id")
+		if !ok {
+			return
+		}
+
+		// The note is optional, so an empty body is fine
+		var input transitionRequest
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped && !rt.ownsOrder(orderID, userID) {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+
+		order, err := rt.orders.WithContext(r.Context()).Transition(orderID, status, actor(r), input.Note)
+		if err != nil {
+			writeOrderError(w, err, "Failed to update order status")
+			return
+		}
+
+		w.Header().Set("ETag", etag(order.Version))
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Order status updated successfully",
+			"status":  "success",
+			"data":    order,
+		})
+	}
+}
+
+func (rt *router) getOrderHistory(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped && !rt.ownsOrder(orderID, userID) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	history, err := rt.orders.WithContext(r.Context()).History(orderID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve order history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   history,
+		"status": "success",
+		"count":  len(history),
+	})
+}
+
+// checkout places a whole order at once. Staff may check out on behalf of a
+// customer by passing userId; everyone else orders for themselves.
+func (rt *router) checkout(w http.ResponseWriter, r *http.Request) {
+	var input checkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	userID, scoped := ownerScope(r, middleware.PermManageOrders)
+	if !scoped {
+		userID = input.UserID
+		if userID == 0 {
+			userID, _ = actorID(r)
+		}
+	}
+	if userID == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	order, err := rt.orders.WithContext(r.Context()).Checkout(services.CheckoutInput{
+		UserID:      userID,
+		Items:       input.Items,
+		Address:     input.Address,
+		PaymentType: input.PaymentType,
+		Actor:       actor(r),
+	})
+	var unavailable *services.UnavailableError
+	switch {
+	case errors.As(err, &unavailable):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"message":     "Some items are unavailable",
+			"status":      "error",
+			"unavailable": unavailable.Items,
+		})
+		return
+	case err != nil:
+		writeOrderError(w, err, "Failed to place order")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Order placed successfully",
+		"status":  "success",
+		"data":    order,
+	})
+}
+
+func (rt *router) getProductStock(w http.ResponseWriter, r *http.Request) {
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	level, err := rt.orders.WithContext(r.Context()).Stock(productID)
+	if err != nil {
+		writeOrderError(w, err, "Failed to retrieve stock")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   level,
+		"status": "success",
+	})
+}
@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+type paramsKey struct{}
+
+// params holds the named segments captured while matching a route pattern
+type params map[string]string
+
+// withParams stores the captured path parameters in the request context
+func withParams(req *http.Request, p params) *http.Request {
+	if len(p) == 0 {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), paramsKey{}, p))
+}
+
+// Param returns the value of the named path parameter, or "" if the route has none
+func Param(r *http.Request, name string) string {
+	p, _ := r.Context().Value(paramsKey{}).(params)
+	return p[name]
+}
+
+// IntParam parses the named path parameter as a positive numeric ID.
+// On failure it writes a 400 response and returns false, so handlers can simply return.
+func IntParam(w http.ResponseWriter, r *http.Request, name string) (uint, bool) {
+	value := Param(r, name)
+	if value == "" {
+		http.Error(w, "Path parameter '"+name+"' is required", http.StatusBadRequest)
+		return 0, false
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id == 0 {
+		http.Error(w, "Path parameter '"+name+"' must be a positive integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
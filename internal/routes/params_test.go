@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newBareRouter returns a router without services, for matching tests
+func newBareRouter() *router {
+	r := &router{root: newNode()}
+	r.group = &group{router: r}
+	return r
+}
+
+func TestIntParam(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   uint
+		ok     bool
+		status int
+	}{
+		{"42", 42, true, http.StatusOK},
+		{"007", 7, true, http.StatusOK},
+		{"", 0, false, http.StatusBadRequest},
+		{"0", 0, false, http.StatusBadRequest},
+		{"-1", 0, false, http.StatusBadRequest},
+		{"1.5", 0, false, http.StatusBadRequest},
+		{"abc", 0, false, http.StatusBadRequest},
+		{"99999999999999999999", 0, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := withParams(httptest.NewRequest(http.MethodGet, "/", nil), params{"id": tt.value})
+		rec := httptest.NewRecorder()
+		got, ok := IntParam(rec, req, "id")
+		if got != tt.want || ok != tt.ok || rec.Code != tt.status {
+			t.Errorf("IntParam(%q) = %d, %v with %d, want %d, %v with %d", tt.value, got, ok, rec.Code, tt.want, tt.ok, tt.status)
+		}
+	}
+}
+
+func TestParamsCapturedByRouter(t *testing.T) {
+	r := newBareRouter()
+	var got map[string]string
+	r.AddRoute(http.MethodGet, "/orders/:id/items/:itemId", func(w http.ResponseWriter, req *http.Request) {
+		got = map[string]string{"id": Param(req, "id"), "itemId": Param(req, "itemId"), "missing": Param(req, "missing")}
+	})
+
+	tests := []struct {
+		path, id, itemID string
+	}{
+		{"/orders/3/items/14", "3", "14"},
+		{"/orders/3/items/14/", "3", "14"},
+		{"/orders/abc/items/x", "abc", "x"},
+	}
+	for _, tt := range tests {
+		got = nil
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got["id"] != tt.id || got["itemId"] != tt.itemID || got["missing"] != "" {
+			t.Errorf("%s captured %v, want id %q and itemId %q", tt.path, got, tt.id, tt.itemID)
+		}
+	}
+
+	// A request that matched no parameters has none in its context
+	if value := Param(httptest.NewRequest(http.MethodGet, "/", nil), "id"); value != "" {
+		t.Errorf("Param without a match = %q, want empty", value)
+	}
+}
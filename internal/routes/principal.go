@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// actor returns the subject of the authenticated caller, used to fill
+// fields such as Product.UpdateBy instead of trusting the request body
+func actor(r *http.Request) string {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	return principal.Subject
+}
+
+// actorID returns the caller's user ID parsed from the token subject
+func actorID(r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(actor(r), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ownerScope reports whether the caller may only see their own records,
+// which is the case when they lack the given manage permission. The
+// returned user ID is the one queries must be restricted to; callers whose
+// subject is not a user ID are scoped to nothing.
+func ownerScope(r *http.Request, manage middleware.Permission) (uint, bool) {
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if principal.Can(manage) {
+		return 0, false
+	}
+	userID, _ := actorID(r)
+	return userID, true
+}
+
+// ownsOrder reports whether the order exists and belongs to userID
+func (rt *router) ownsOrder(orderID uint, userID uint) bool {
+	var count int64
+	rt.db.Model(&models.Order{}).Where("id = ? AND user_id = ?", orderID, userID).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"go_boilerplate/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOwnerScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *middleware.Principal
+		userID    uint
+		scoped    bool
+	}{
+		{"staff see every order", &middleware.Principal{Subject: "1", Roles: []string{middleware.RoleStaff}}, 0, false},
+		{"customers see their own", &middleware.Principal{Subject: "42", Roles: []string{middleware.RoleCustomer}}, 42, true},
+		{"technicians see their own orders", &middleware.Principal{Subject: "9", Roles: []string{middleware.RoleTechnician}}, 9, true},
+		{"a subject that is no user ID sees nothing", &middleware.Principal{Subject: "svc", Roles: []string{middleware.RoleCustomer}}, 0, true},
+		{"anonymous callers see nothing", nil, 0, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.principal != nil {
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), tt.principal))
+		}
+		userID, scoped := ownerScope(req, middleware.PermManageOrders)
+		if userID != tt.userID || scoped != tt.scoped {
+			t.Errorf("%s: ownerScope = %d, %v, want %d, %v", tt.name, userID, scoped, tt.userID, tt.scoped)
+		}
+		if tt.principal != nil && actor(req) != tt.principal.Subject {
+			t.Errorf("%s: actor = %q, want %q", tt.name, actor(req), tt.principal.Subject)
+		}
+	}
+}
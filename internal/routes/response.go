@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeJSON encodes response as the JSON body of a reply with the given status
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
@@ -2,338 +2,232 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go_boilerplate/internal/config"
 	"go_boilerplate/internal/middleware"
 	"go_boilerplate/internal/models"
+	"go_boilerplate/internal/services"
 	"go_boilerplate/pkg"
-	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type router struct {
-	routes map[string]map[string]http.HandlerFunc
-	db     *gorm.DB
+	*group
+	root      *node
+	config    *config.Config
+	db        *gorm.DB
+	auth      *services.AuthService
+	orders    *services.OrderService
+	inventory *services.InventoryService
+	uploads   *services.UploadService
+	storage   pkg.Storage
 }
 
-func NewRouter(db *gorm.DB) *router {
-	return &router{
-		routes: make(map[string]map[string]http.HandlerFunc),
-		db:     db,
-	}
+func NewRouter(cfg *config.Config, db *gorm.DB, auth *services.AuthService, orders *services.OrderService, uploads *services.UploadService, storage pkg.Storage) *router {
+	r := &router{
+		root:      newNode(),
+		config:    cfg,
+		db:        db,
+		auth:      auth,
+		orders:    orders,
+		inventory: services.NewInventoryService(db),
+		uploads:   uploads,
+		storage:   storage,
+	}
+	r.group = &group{router: r}
+	return r
 }
 
-func InitializeRoutes(db *gorm.DB) *router {
-	r := NewRouter(db)
-
-	// Define the final handler that will return the data
-	// finalHandler := http.HandlerFunc(r.testHandler)
-	addUserHandler := http.HandlerFunc(r.inputData)
-
-	// Brand handlers
-	addBrandHandler := http.HandlerFunc(r.inputBrand)
-	getBrandHandler := http.HandlerFunc(r.getBrand)
-	deleteBrandHandler := http.HandlerFunc(r.deleteBrand)
-	updateBrandHandler := http.HandlerFunc(r.updateBrand)
-
-	// Category handlers
-	addCategoryHandler := http.HandlerFunc(r.inputCategory)
-	getCategoryHandler := http.HandlerFunc(r.getCategory)
-	deleteCategoryHandler := http.HandlerFunc(r.deleteCategory)
-	updateCategoryHandler := http.HandlerFunc(r.updateCategory)
-
-	// Product handlers
-	getProductHandler := http.HandlerFunc(r.getProduct)
-	addProductHandler := http.HandlerFunc(r.inputProduct)
-	updateProductHandler := http.HandlerFunc(r.updateProduct)
-	deleteProductHandler := http.HandlerFunc(r.deleteProduct)
-
-	// Order handlers
-	getOrderHandler := http.HandlerFunc(r.getOrder)
-	addOrderHandler := http.HandlerFunc(r.inputOrder)
-	updateOrderHandler := http.HandlerFunc(r.updateOrder)
-	deleteOrderHandler := http.HandlerFunc(r.deleteOrder)
-
-	// Repair handlers
-	getRepairHandler := http.HandlerFunc(r.getRepair)
-	addRepairHandler := http.HandlerFunc(r.inputRepair)
-	updateRepairHandler := http.HandlerFunc(r.updateRepair)
-	deleteRepairHandler := http.HandlerFunc(r.deleteRepair)
-
-	// RepairStatus handlers
-	getRepairStatusHandler := http.HandlerFunc(r.getRepairStatus)
-	addRepairStatusHandler := http.HandlerFunc(r.inputRepairStatus)
-	updateRepairStatusHandler := http.HandlerFunc(r.updateRepairStatus)
-	deleteRepairStatusHandler := http.HandlerFunc(r.deleteRepairStatus)
-
-	// ProductUpdateHistory handlers
-	getProductUpdateHistoryHandler := http.HandlerFunc(r.getProductUpdateHistory)
-	addProductUpdateHistoryHandler := http.HandlerFunc(r.inputProductUpdateHistory)
-	deleteProductUpdateHistoryHandler := http.HandlerFunc(r.deleteProductUpdateHistory)
-
-	// Payment handlers
-	getPaymentHandler := http.HandlerFunc(r.getPayment)
-	addPaymentHandler := http.HandlerFunc(r.inputPayment)
-	updatePaymentHandler := http.HandlerFunc(r.updatePayment)
-	deletePaymentHandler := http.HandlerFunc(r.deletePayment)
-
-	// Shipping handlers
-	getShippingHandler := http.HandlerFunc(r.getShipping)
-	addShippingHandler := http.HandlerFunc(r.inputShipping)
-	updateShippingHandler := http.HandlerFunc(r.updateShipping)
-	deleteShippingHandler := http.HandlerFunc(r.deleteShipping)
-
-	// ProductPerOrder handlers
-	getProductPerOrderHandler := http.HandlerFunc(r.getProductPerOrder)
-	addProductPerOrderHandler := http.HandlerFunc(r.inputProductPerOrder)
-	deleteProductPerOrderHandler := http.HandlerFunc(r.deleteProductPerOrder)
-
-	// Apply middleware to the final handler
-	r.AddRoute("GET", "/users", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(addUserHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/users", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(addUserHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("GET", "/brands", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(getBrandHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+// requestDB returns the database bound to the request's context, so the
+// audit log can attribute changes to the caller
+func (rt *router) requestDB(r *http.Request) *gorm.DB {
+	return rt.db.WithContext(r.Context())
+}
 
-	r.AddRoute("POST", "/brands", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(addBrandHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+func InitializeRoutes(cfg *config.Config, db *gorm.DB, authService *services.AuthService, orderService *services.OrderService, uploadService *services.UploadService, storage pkg.Storage, auth middleware.MiddlewareFunc) *router {
+	r := NewRouter(cfg, db, authService, orderService, uploadService, storage)
 
-	r.AddRoute("DELETE", "/brands/:id", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(deleteBrandHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Middleware shared by every route
+	r.Use(testmw)
 
-	r.AddRoute("PUT", "/brands/:id", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(updateBrandHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Public catalog routes; a bearer token is optional and only needed
+	// for ?include_deleted
+	public := r.Group("/", middleware.Optional(auth))
+	public.AddRoute("GET", "/brands", r.getBrand)
+	public.AddRoute("GET", "/categories", r.getCategory)
+	public.AddRoute("GET", "/products", r.getProduct)
+	public.AddRoute("GET", "/products/:id/stock", r.getProductStock)
 
-	// Category routes
-	r.AddRoute("GET", "/categories", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(getCategoryHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Single reads carry an ETag; writes must send it back in If-Match
+	public.AddRoute("GET", "/brands/:id", r.getBrandByID)
+	public.AddRoute("GET", "/categories/:id", r.getCategoryByID)
+	public.AddRoute("GET", "/products/:id", r.getProductByID)
+	public.AddRoute("GET", "/products/:id/variants/:variantId", r.getVariantByID)
 
-	r.AddRoute("POST", "/categories", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(addCategoryHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Uploaded files kept on local disk are served by the API itself, which
+	// also takes the direct uploads S3 would otherwise receive
+	if cfg.Storage.Backend == "local" {
+		r.AddRoute("GET", joinPath(cfg.Storage.PublicURL, "*key"), r.serveUpload)
+		r.AddRoute("PUT", joinPath(cfg.Storage.PublicURL, "*key"), r.receiveUpload)
+	}
 
-	r.AddRoute("DELETE", "/categories/:id", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(deleteCategoryHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Account routes
+	accounts := r.Group("/auth")
+	accounts.AddRoute("POST", "/register", r.register)
+	accounts.AddRoute("POST", "/login", r.login)
+	accounts.AddRoute("POST", "/refresh", r.refresh)
+	accounts.AddRoute("POST", "/logout", r.logout)
 
-	r.AddRoute("PUT", "/categories/:id", func(w http.ResponseWriter, req *http.Request) {
-		// Create middleware chain and execute it
-		handler := middleware.SetHandler(updateCategoryHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Everything else requires a valid bearer token
+	api := r.Group("/", auth)
 
-	// Product routes
-	r.AddRoute("GET", "/products", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getProductHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/products", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addProductHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("PUT", "/products/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(updateProductHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/products/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deleteProductHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	api.AddRoute("GET", "/users/me", r.getMe)
 
-	// Order routes
-	r.AddRoute("GET", "/orders", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getOrderHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/orders", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addOrderHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("PUT", "/orders/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(updateOrderHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/orders/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deleteOrderHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// User management routes
+	users := api.Group("/users", middleware.RequirePermission(middleware.PermManageUsers))
+	users.AddRoute("GET", "/", r.getUser)
+	users.AddRoute("POST", "/", r.inputUser)
 
-	// Repair routes
-	r.AddRoute("GET", "/repairs", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getRepairHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/repairs", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addRepairHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("PUT", "/repairs/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(updateRepairHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/repairs/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deleteRepairHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Catalog management is limited to admin and staff
+	catalog := api.Group("/", middleware.RequirePermission(middleware.PermManageCatalog))
 
-	// RepairStatus routes
-	r.AddRoute("GET", "/repair-statuses", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getRepairStatusHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/repair-statuses", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addRepairStatusHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("PUT", "/repair-statuses/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(updateRepairStatusHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/repair-statuses/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deleteRepairStatusHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	// Brand routes
+	brands := catalog.Group("/brands")
+	brands.AddRoute("POST", "/", r.inputBrand)
+	brands.AddRoute("PUT", "/:id", r.updateBrand)
+	brands.AddRoute("DELETE", "/:id", r.deleteBrand)
+	brands.AddRoute("POST", "/:id/restore", r.restoreBrand)
+
+	// Category routes
+	categories := catalog.Group("/categories")
+	categories.AddRoute("POST", "/", r.inputCategory)
+	categories.AddRoute("PUT", "/:id", r.updateCategory)
+	categories.AddRoute("DELETE", "/:id", r.deleteCategory)
+	categories.AddRoute("POST", "/:id/restore", r.restoreCategory)
+
+	// Product routes
+	products := catalog.Group("/products")
+	products.AddRoute("POST", "/", r.inputProduct)
+	products.AddRoute("PUT", "/:id", r.updateProduct)
+	products.AddRoute("DELETE", "/:id", r.deleteProduct)
+	products.AddRoute("POST", "/:id/restore", r.restoreProduct)
+	products.AddRoute("GET", "/:id/movements", r.getStockMovements)
+
+	// Product variant routes
+	products.AddRoute("POST", "/:id/variants", r.inputVariant)
+	products.AddRoute("PUT", "/:id/variants/:variantId", r.updateVariant)
+	products.AddRoute("DELETE", "/:id/variants/:variantId", r.deleteVariant)
+
+	// Product image routes
+	products.AddRoute("POST", "/:id/images", r.addProductImages)
+	products.AddRoute("PUT", "/:id/images", r.reorderProductImages)
+	products.AddRoute("PUT", "/:id/images/:imageId", r.updateProductImage)
+	products.AddRoute("DELETE", "/:id/images/:imageId", r.deleteProductImage)
+
+	// Stock ledger routes; technicians may only book parts used in repairs
+	api.Group("/products", middleware.RequirePermission(middleware.PermManageCatalog, middleware.PermManageRepairs)).
+		AddRoute("POST", "/:id/movements", r.inputStockMovement)
+	inventory := catalog.Group("/inventory")
+	inventory.AddRoute("GET", "/reconcile", r.getStockReconciliation)
+	inventory.AddRoute("POST", "/reconcile", r.reconcileStock)
 
 	// ProductUpdateHistory routes
-	r.AddRoute("GET", "/product-histories", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getProductUpdateHistoryHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/product-histories", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addProductUpdateHistoryHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/product-histories/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deleteProductUpdateHistoryHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	productHistories := catalog.Group("/product-histories")
+	productHistories.AddRoute("GET", "/", r.getProductUpdateHistory)
+	productHistories.AddRoute("POST", "/", r.inputProductUpdateHistory)
+	productHistories.Group("/", middleware.RequirePermission(middleware.PermManageHistory)).
+		AddRoute("DELETE", "/:id", r.deleteProductUpdateHistory)
+
+	// Direct uploads of product and repair images to storage; which
+	// targets a caller may use is checked per upload
+	directUploads := api.Group("/direct-uploads", middleware.RequirePermission(
+		middleware.PermManageCatalog, middleware.PermManageRepairs, middleware.PermRequestRepairs))
+	directUploads.AddRoute("POST", "/", r.startDirectUpload)
+	directUploads.AddRoute("POST", "/:id/complete", r.completeDirectUpload)
+
+	// Audit log of field level changes
+	api.Group("/changes", middleware.RequirePermission(middleware.PermManageHistory)).
+		AddRoute("GET", "/", r.getEntityChanges)
+
+	// Order related routes; customers only see and create their own
+	ordering := api.Group("/", middleware.RequirePermission(middleware.PermPlaceOrders, middleware.PermManageOrders))
+	orderManagement := ordering.Group("/", middleware.RequirePermission(middleware.PermManageOrders))
+
+	// Order routes
+	ordering.AddRoute("GET", "/orders", r.getOrder)
+	ordering.AddRoute("GET", "/orders/:id", r.getOrderByID)
+	ordering.AddRoute("POST", "/orders", r.inputOrder)
+	orderManagement.AddRoute("PUT", "/orders/:id", r.updateOrder)
+	orderManagement.AddRoute("DELETE", "/orders/:id", r.deleteOrder)
+	orderManagement.AddRoute("POST", "/orders/:id/restore", r.restoreOrder)
+
+	// Places an order with its lines, shipping and payment in one step
+	ordering.AddRoute("POST", "/checkout", r.checkout)
+
+	// Order lifecycle; customers may only cancel their own pending orders
+	ordering.AddRoute("GET", "/orders/:id/history", r.getOrderHistory)
+	ordering.AddRoute("POST", "/orders/:id/cancel", r.transitionOrder(models.OrderStatusCancelled))
+	orderManagement.AddRoute("POST", "/orders/:id/pay", r.transitionOrder(models.OrderStatusPaid))
+	orderManagement.AddRoute("POST", "/orders/:id/pack", r.transitionOrder(models.OrderStatusPacked))
+	orderManagement.AddRoute("POST", "/orders/:id/ship", r.transitionOrder(models.OrderStatusShipped))
+	orderManagement.AddRoute("POST", "/orders/:id/deliver", r.transitionOrder(models.OrderStatusDelivered))
+	orderManagement.AddRoute("POST", "/orders/:id/refund", r.transitionOrder(models.OrderStatusRefunded))
 
 	// Payment routes
-	r.AddRoute("GET", "/payments", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getPaymentHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/payments", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addPaymentHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("PUT", "/payments/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(updatePaymentHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/payments/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deletePaymentHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	ordering.AddRoute("GET", "/payments", r.getPayment)
+	ordering.AddRoute("GET", "/payments/:id", r.getPaymentByID)
+	ordering.AddRoute("POST", "/payments", r.inputPayment)
+	orderManagement.AddRoute("PUT", "/payments/:id", r.updatePayment)
+	orderManagement.AddRoute("DELETE", "/payments/:id", r.deletePayment)
 
 	// Shipping routes
-	r.AddRoute("GET", "/shippings", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getShippingHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/shippings", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addShippingHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("PUT", "/shippings/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(updateShippingHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/shippings/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deleteShippingHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	ordering.AddRoute("GET", "/shippings", r.getShipping)
+	ordering.AddRoute("GET", "/shippings/:id", r.getShippingByID)
+	ordering.AddRoute("POST", "/shippings", r.inputShipping)
+	orderManagement.AddRoute("PUT", "/shippings/:id", r.updateShipping)
+	orderManagement.AddRoute("DELETE", "/shippings/:id", r.deleteShipping)
 
 	// ProductPerOrder routes
-	r.AddRoute("GET", "/product-orders", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(getProductPerOrderHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("POST", "/product-orders", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(addProductPerOrderHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
-	r.AddRoute("DELETE", "/product-orders/:id", func(w http.ResponseWriter, req *http.Request) {
-		handler := middleware.SetHandler(deleteProductPerOrderHandler)
-		chain := handler.Chain(testmw)
-		chain.ServeHTTP(w, req)
-	})
+	ordering.AddRoute("GET", "/product-orders", r.getProductPerOrder)
+	ordering.AddRoute("POST", "/product-orders", r.inputProductPerOrder)
+	orderManagement.AddRoute("DELETE", "/product-orders/:id", r.deleteProductPerOrder)
+
+	// Repair related routes; customers only see and create their own
+	repairing := api.Group("/", middleware.RequirePermission(middleware.PermRequestRepairs, middleware.PermManageRepairs))
+	repairManagement := repairing.Group("/", middleware.RequirePermission(middleware.PermManageRepairs))
+
+	// Repair routes
+	repairing.AddRoute("GET", "/repairs", r.getRepair)
+	repairing.AddRoute("GET", "/repairs/:id", r.getRepairByID)
+	repairing.AddRoute("POST", "/repairs", r.inputRepair)
+	repairManagement.AddRoute("PUT", "/repairs/:id", r.updateRepair)
+	repairManagement.AddRoute("DELETE", "/repairs/:id", r.deleteRepair)
+
+	// RepairStatus routes
+	repairing.AddRoute("GET", "/repair-statuses", r.getRepairStatus)
+	repairing.AddRoute("GET", "/repair-statuses/:id", r.getRepairStatusByID)
+	repairManagement.AddRoute("POST", "/repair-statuses", r.inputRepairStatus)
+	repairManagement.AddRoute("PUT", "/repair-statuses/:id", r.updateRepairStatus)
+	repairManagement.AddRoute("DELETE", "/repair-statuses/:id", r.deleteRepairStatus)
 
 	return r
 }
 
 func (rt *router) updateBrand(w http.ResponseWriter, r *http.Request) {
-	// Extract brand ID from the URL path
-	brandID := r.URL.Path[len("/brands/"):]
-	if brandID == "" {
-		http.Error(w, "Brand ID is required", http.StatusBadRequest)
+	brandID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -343,18 +237,20 @@ func (rt *router) updateBrand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Attempt to update the brand by ID
-	result := rt.db.Model(&models.Brand{}).Where("id = ?", brandID).Updates(brand)
+	// The update only applies to the version the client read
+	brand.Version = version + 1
+	result := rt.requestDB(r).Model(&models.Brand{}).Where("id = ? AND version = ?", brandID, version).Updates(brand)
 	if result.Error != nil {
 		http.Error(w, "Failed to update brand", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Brand not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Brand{}, brandID, "Brand")
 		return
 	}
 
+	w.Header().Set("ETag", etag(brand.Version))
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"message": "Brand updated successfully",
@@ -370,22 +266,25 @@ func (rt *router) updateBrand(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deleteBrand(w http.ResponseWriter, r *http.Request) {
-	// Extract brand ID from the URL path
-	brandID := r.URL.Path[len("/brands/"):]
-	if brandID == "" {
-		http.Error(w, "Brand ID is required", http.StatusBadRequest)
+	brandID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
 	// Attempt to delete the brand by ID
-	result := rt.db.Delete(&models.Brand{}, brandID)
+	result := rt.requestDB(r).Where("version = ?", version).Delete(&models.Brand{}, brandID)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete brand", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Brand not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Brand{}, brandID, "Brand")
 		return
 	}
 
@@ -405,7 +304,11 @@ func (rt *router) deleteBrand(w http.ResponseWriter, r *http.Request) {
 
 func (rt *router) getBrand(w http.ResponseWriter, r *http.Request) {
 	var brands []models.Brand
-	result := rt.db.Find(&brands)
+	query, ok := withDeleted(w, r, rt.requestDB(r), middleware.PermManageCatalog)
+	if !ok {
+		return
+	}
+	result := query.Find(&brands)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve brands", http.StatusInternalServerError)
 		return
@@ -434,31 +337,9 @@ func (rt *router) inputBrand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	fmt.Print(brand.Name)
-	brand.CreatedAt = "2023-10-01"
-	brand.UpdatedAt = "2023-10-01"
-	result := rt.db.Create(&brand)
-	fmt.Println(result)
-	w.WriteHeader(http.StatusOK)
-	response := map[string]interface{}{
-		"message": "Hello, World!",
-		"status":  "success",
-		"data": map[string]interface{}{
-			"id":   1,
-			"name": "Sample User",
-		},
-	}
-	jsonResponse, err := json.Marshal(response)
-	if err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResponse)
-}
-
-func (rt *router) inputData(w http.ResponseWriter, r *http.Request) {
-	brand := models.Brand{Name: "test2", CreatedAt: "2023-10-01", UpdatedAt: "2023-10-01"}
-	result := rt.db.Create(&brand)
+	brand.CreatedAt = time.Now()
+	brand.UpdatedAt = time.Now()
+	result := rt.requestDB(r).Create(&brand)
 	fmt.Println(result)
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
@@ -508,64 +389,35 @@ func (rt *router) testHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	path := req.URL.Path
-	method := req.Method
-
-	// First try exact match
-	if handlers, ok := r.routes[path]; ok {
-		if handler, ok := handlers[method]; ok {
-			handler(w, req)
-			return
-		}
+	p := params{}
+	route := r.root.lookup(splitPath(req.URL.Path), p)
+	if route == nil {
+		http.NotFound(w, req)
+		return
 	}
 
-	// If no exact match, try to match patterns with parameters
-	for routePath, handlers := range r.routes {
-		if handler, ok := handlers[method]; ok {
-			// Check if the route contains a parameter (e.g., /:id)
-			if pathMatches(routePath, path) {
-				handler(w, req)
-				return
-			}
-		}
+	handler, ok := route.handlers[req.Method]
+	if !ok && req.Method == http.MethodHead {
+		// HEAD falls back to GET; the server discards the body
+		handler, ok = route.handlers[http.MethodGet]
 	}
-
-	http.NotFound(w, req)
-}
-
-// pathMatches checks if a URL path matches a route pattern with parameters
-func pathMatches(pattern, path string) bool {
-	// Split the pattern and path into segments
-	patternParts := splitPath(pattern)
-	pathParts := splitPath(path)
-
-	// If they have different number of segments, they don't match
-	if len(patternParts) != len(pathParts) {
-		return false
-	}
-
-	// Check each segment
-	for i, part := range patternParts {
-		// If this segment is a parameter (starts with :), it matches anything
-		if len(part) > 0 && part[0] == ':' {
-			continue
-		}
-
-		// Otherwise, segments must match exactly
-		if part != pathParts[i] {
-			return false
+	if !ok {
+		w.Header().Set("Allow", route.allowed())
+		if req.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
 		}
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
 	}
 
-	return true
+	handler(w, withParams(req, p))
 }
 
 // splitPath splits a URL path into segments
 func splitPath(path string) []string {
-	// Remove leading slash if present
-	if len(path) > 0 && path[0] == '/' {
-		path = path[1:]
-	}
+	// Remove leading and trailing slashes if present
+	path = strings.Trim(path, "/")
 
 	// Handle empty path
 	if path == "" {
@@ -575,17 +427,14 @@ func splitPath(path string) []string {
 	return strings.Split(path, "/")
 }
 
-func (r *router) AddRoute(method, path string, handler http.HandlerFunc) {
-	if r.routes[path] == nil {
-		r.routes[path] = make(map[string]http.HandlerFunc)
-	}
-	r.routes[path][method] = handler
-}
-
 // Category CRUD handlers
 func (rt *router) getCategory(w http.ResponseWriter, r *http.Request) {
 	var categories []models.Category
-	result := rt.db.Find(&categories)
+	query, ok := withDeleted(w, r, rt.requestDB(r), middleware.PermManageCatalog)
+	if !ok {
+		return
+	}
+	result := query.Find(&categories)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
 		return
@@ -614,8 +463,8 @@ func (rt *router) inputCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	category.CreatedAt = "2023-10-01"
-	result := rt.db.Create(&category)
+	category.CreatedAt = time.Now()
+	result := rt.requestDB(r).Create(&category)
 	if result.Error != nil {
 		http.Error(w, "Failed to create category", http.StatusInternalServerError)
 		return
@@ -637,10 +486,13 @@ func (rt *router) inputCategory(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) updateCategory(w http.ResponseWriter, r *http.Request) {
-	// Extract category ID from the URL path
-	categoryID := r.URL.Path[len("/categories/"):]
-	if categoryID == "" {
-		http.Error(w, "Category ID is required", http.StatusBadRequest)
+	categoryID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -650,18 +502,20 @@ func (rt *router) updateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Attempt to update the category by ID
-	result := rt.db.Model(&models.Category{}).Where("id = ?", categoryID).Updates(category)
+	// The update only applies to the version the client read
+	category.Version = version + 1
+	result := rt.requestDB(r).Model(&models.Category{}).Where("id = ? AND version = ?", categoryID, version).Updates(category)
 	if result.Error != nil {
 		http.Error(w, "Failed to update category", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Category not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Category{}, categoryID, "Category")
 		return
 	}
 
+	w.Header().Set("ETag", etag(category.Version))
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"message": "Category updated successfully",
@@ -677,22 +531,25 @@ func (rt *router) updateCategory(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deleteCategory(w http.ResponseWriter, r *http.Request) {
-	// Extract category ID from the URL path
-	categoryID := r.URL.Path[len("/categories/"):]
-	if categoryID == "" {
-		http.Error(w, "Category ID is required", http.StatusBadRequest)
+	categoryID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
 	// Attempt to delete the category by ID
-	result := rt.db.Delete(&models.Category{}, categoryID)
+	result := rt.requestDB(r).Where("version = ?", version).Delete(&models.Category{}, categoryID)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Category not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Category{}, categoryID, "Category")
 		return
 	}
 
@@ -713,12 +570,22 @@ func (rt *router) deleteCategory(w http.ResponseWriter, r *http.Request) {
 // Product CRUD handlers
 func (rt *router) getProduct(w http.ResponseWriter, r *http.Request) {
 	var products []models.Product
-	// Preload related brand and category data for each product
-	result := rt.db.Preload("Brand").Preload("Category").Find(&products)
+	query, ok := withDeleted(w, r, rt.requestDB(r), middleware.PermManageCatalog)
+	if !ok {
+		return
+	}
+	// Preload related brand and category data for each product, even when
+	// the brand or category itself has been deleted, and list each
+	// product's variants under it
+	result := query.Preload("Brand", unscoped).Preload("Category", unscoped).
+		Preload("Images", byPosition).Preload("Variants", orderByID).Find(&products)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve products", http.StatusInternalServerError)
 		return
 	}
+	for i := range products {
+		rt.resolveImageURL(&products[i])
+	}
 
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
@@ -736,35 +603,27 @@ func (rt *router) getProduct(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonResponse)
 }
 
+// inputProduct creates a product from a multipart form. Images are
+// optional; every file sent in the image field is attached in order, the
+// first one as the primary image.
 func (rt *router) inputProduct(w http.ResponseWriter, r *http.Request) {
 	r.ParseMultipartForm(10 << 20)
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "Failed to parse form file", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
 
-	filebyte, err := io.ReadAll(file)
+	brandID := r.FormValue("brandId")
+	categoryID := r.FormValue("categoryId")
+	name := r.FormValue("name")
+	price, err := models.ParseMoney(r.FormValue("price"), r.FormValue("currency"))
 	if err != nil {
-		http.Error(w, "Unable to read file", http.StatusInternalServerError)
+		http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	fmt.Printf("File bytes: %d\n", len(filebyte))
-	s3 := pkg.NewS3Config()
-	url, err := s3.S3ImageUpload(filebyte, handler.Filename)
-	if err != nil {
-		http.Error(w, "Unable to upload image to S3", http.StatusInternalServerError)
-		return
+	stock := 0
+	if value := r.FormValue("stock"); value != "" {
+		if stock, err = strconv.Atoi(value); err != nil || stock < 0 {
+			http.Error(w, "Invalid stock", http.StatusBadRequest)
+			return
+		}
 	}
-	fmt.Printf("File URL: %s\n", url)
-
-	brandID := r.FormValue("brandId")
-	categoryID := r.FormValue("categoryId")
-	name := r.FormValue("name")
-	price := r.FormValue("price")
-	stock := r.FormValue("stock")
-	updateBy := r.FormValue("updateBy")
 
 	// var product models.Product
 	// if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
@@ -774,9 +633,9 @@ func (rt *router) inputProduct(w http.ResponseWriter, r *http.Request) {
 
 	// First, check if the brand_id exists and get the brand info
 	var brandName string
+	var brand models.Brand
 	if brandID != "" {
-		var brand models.Brand
-		if err := rt.db.First(&brand, brandID).Error; err != nil {
+		if err := rt.requestDB(r).First(&brand, brandID).Error; err != nil {
 			http.Error(w, "Invalid brand ID", http.StatusBadRequest)
 			return
 		}
@@ -790,36 +649,74 @@ func (rt *router) inputProduct(w http.ResponseWriter, r *http.Request) {
 	// Check if category exists
 	// if categoryID != "" {
 	// 	var category models.Category
-	// 	if err := rt.db.First(&category, categoryID).Error; err != nil {
+	// 	if err := rt.requestDB(r).First(&category, categoryID).Error; err != nil {
 	// 		http.Error(w, "Invalid category ID", http.StatusBadRequest)
 	// 		return
 	// 	}
 	// }
 
-	// Create a map for inserting the product with all required fields
-	productMap := map[string]interface{}{
-		"brand_id": brandID,
-		// "brand":       brandName, // This is the key addition - setting the brand text field
-		"name":        name,
-		"price":       price,
-		"stock":       stock,
-		"category_id": categoryID,
-		"created_at":  "2023-10-01",
-		"updated_at":  "2023-10-01",
-		"update_by":   updateBy,
-		"image_url":   url,
-	}
-
-	// Create the product using the map to ensure all fields are set
-	result := rt.db.Model(&models.Product{}).Create(productMap)
-	if result.Error != nil {
-		http.Error(w, "Failed to create product: "+result.Error.Error(), http.StatusInternalServerError)
+	category, err := strconv.ParseUint(categoryID, 10, 0)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	uploads, ok := rt.readImages(w, r)
+	if !ok {
 		return
 	}
 
-	// // Get the created product with its ID
-	var createdProduct models.Product
-	rt.db.First(&createdProduct, "name = ? AND brand_id = ?", name, brandID)
+	// The product, its images and its opening stock are created together;
+	// image objects stored for a product that is rolled back are removed
+	createdProduct := models.Product{
+		BrandID:    brand.ID,
+		Name:       name,
+		Price:      price,
+		Stock:      0, // Booked through the ledger below
+		CategoryID: uint(category),
+		UpdateBy:   actor(r),
+	}
+	var uploadErr error
+	err = rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&createdProduct).Error; err != nil {
+			return err
+		}
+		// Image keys live under the product, so they are stored once it exists
+		if uploadErr = rt.storeUploads(r, productImagePrefix(createdProduct.ID), uploads); uploadErr != nil {
+			return uploadErr
+		}
+		var err error
+		if createdProduct.Images, err = attachImages(tx, createdProduct.ID, uploads, true); err != nil {
+			return err
+		}
+		if stock == 0 {
+			return nil
+		}
+		_, err = rt.inventory.WithTx(tx).Record(models.StockMovement{
+			ProductID: createdProduct.ID,
+			Kind:      models.MovementReceipt,
+			Quantity:  stock,
+			Reason:    "initial stock",
+			Actor:     actor(r),
+		})
+		if err != nil {
+			return err
+		}
+		createdProduct.Stock = stock
+		createdProduct.Version++
+		return nil
+	})
+	if uploadErr != nil {
+		writeUploadError(w, uploadErr)
+		return
+	}
+	if err != nil {
+		rt.discardUploads(r, uploads)
+		fmt.Printf("Failed to create product: %v\n", err)
+		writeInventoryError(w, err, "Failed to create product")
+		return
+	}
+	rt.resolveImageURL(&createdProduct)
 
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
@@ -836,120 +733,111 @@ func (rt *router) inputProduct(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonResponse)
 }
 
+// updateProduct changes the product's fields. Images are managed through
+// the product image routes, so none has to be sent.
 func (rt *router) updateProduct(w http.ResponseWriter, r *http.Request) {
 	r.ParseMultipartForm(10 << 20)
-	productID := r.URL.Path[len("/products/"):]
-	if productID == "" {
-		http.Error(w, "Product ID is required", http.StatusBadRequest)
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
-	file, handler, err := r.FormFile("image")
-	if err != nil {
-		http.Error(w, "Failed to parse form file", http.StatusBadRequest)
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
-	defer file.Close()
-
-	filebyte, err := io.ReadAll(file)
+	var product models.Product
+	if err := rt.requestDB(r).First(&product, productID).Error; err != nil || product.Version != version {
+		rt.preconditionFailed(w, r, &models.Product{}, productID, "Product")
+		return
+	}
+	price, err := models.ParseMoney(r.FormValue("price"), r.FormValue("currency"))
 	if err != nil {
-		http.Error(w, "Unable to read file", http.StatusInternalServerError)
+		http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	fmt.Printf("File bytes: %d\n", len(filebyte))
-	var product models.Product
-	// if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-	// 	http.Error(w, "Invalid request payload", http.StatusBadRequest)
-	// 	return
-	// }
-	rt.db.First(&product, productID)
-	fmt.Printf("Product Name:%s\n " + product.Name)
-	var imageURL string
-	if len(filebyte) != 0 {
-		s3 := pkg.NewS3Config()
-		err = s3.S3ImageDelete(strings.Split(product.ImageURL, "/")[len(strings.Split(product.ImageURL, "/"))-1])
-		if err != nil {
-			http.Error(w, "Unable to delete image on S3", http.StatusInternalServerError)
-			return
-		}
-		url, err := s3.S3ImageUpload(filebyte, handler.Filename)
-		imageURL = url
-		if err != nil {
-			http.Error(w, "Unable to upload image to S3", http.StatusInternalServerError)
+	stock := r.FormValue("stock")
+	onHand := 0
+	if stock != "" {
+		if onHand, err = strconv.Atoi(stock); err != nil || onHand < 0 {
+			http.Error(w, "Invalid stock", http.StatusBadRequest)
 			return
 		}
-		fmt.Printf("File URL: %s\n", url)
-	} else {
-		imageURL = product.ImageURL
 	}
 	brandID := r.FormValue("brandId")
 	categoryID := r.FormValue("categoryId")
 	name := r.FormValue("name")
-	price := r.FormValue("price")
-	stock := r.FormValue("stock")
-	updateBy := r.FormValue("updateBy")
-	updatedAt := "2023-10-01"
-
-	result := rt.db.Model(&models.Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
-		"brand_id":    brandID,
-		"category_id": categoryID,
-		"name":        name,
-		"price":       price,
-		"stock":       stock,
-		"update_by":   updateBy,
-		"image_url":   imageURL,
-		"updated_at":  updatedAt,
+	updatedAt := time.Now()
+
+	// A new stock figure is booked as a ledger adjustment after the version
+	// checked update, in the same transaction, so a stale request or a
+	// rejected figure changes nothing. The adjustment bumps the version once
+	// more.
+	err = rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Product{}).Where("id = ? AND version = ?", productID, version).Updates(map[string]interface{}{
+			"version":        version + 1,
+			"brand_id":       brandID,
+			"category_id":    categoryID,
+			"name":           name,
+			"price_minor":    price.Amount,
+			"price_currency": price.Currency,
+			"update_by":      actor(r),
+			"updated_at":     updatedAt,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStaleProduct
+		}
+		version++
+		if stock == "" {
+			return nil
+		}
+		movement, err := rt.inventory.WithTx(tx).SetStock(productID, nil, onHand, actor(r), "product update")
+		if err != nil {
+			return err
+		}
+		if movement != nil {
+			version++
+		}
+		return nil
 	})
-	if result.Error != nil {
-		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+	if errors.Is(err, errStaleProduct) {
+		rt.preconditionFailed(w, r, &models.Product{}, productID, "Product")
+		return
+	}
+	if err != nil {
+		writeInventoryError(w, err, "Failed to update product")
 		return
 	}
 
-	// if result.RowsAffected == 0 {
-	// 	http.Error(w, "Product not found", http.StatusNotFound)
-	// 	return
-	// }
-
-	// w.WriteHeader(http.StatusOK)
-	// response := map[string]interface{}{
-	// 	"message": "Product updated successfully",
-	// 	"status":  "success",
-	// }
-	// jsonResponse, err := json.Marshal(response)
-	// if err != nil {
-	// 	http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-	// 	return
-	// }
-	// w.Header().Set("Content-Type", "application/json")
-	// w.Write(jsonResponse)
+	w.Header().Set("ETag", etag(version))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Product updated successfully",
+		"status":  "success",
+	})
 }
 
 func (rt *router) deleteProduct(w http.ResponseWriter, r *http.Request) {
-	productID := r.URL.Path[len("/products/"):]
-	if productID == "" {
-		http.Error(w, "Product ID is required", http.StatusBadRequest)
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
-	var product models.Product
-	// if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-	// 	http.Error(w, "Invalid request payload", http.StatusBadRequest)
-	// 	return
-	// }
-	rt.db.First(&product, productID)
-	fmt.Printf("Product Name:%s\n " + product.Name)
-	s3 := pkg.NewS3Config()
-	err := s3.S3ImageDelete(strings.Split(product.ImageURL, "/")[len(strings.Split(product.ImageURL, "/"))-1])
-	if err != nil {
-		http.Error(w, "Unable to delete image on S3", http.StatusInternalServerError)
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
-	result := rt.db.Delete(&models.Product{}, productID)
+	// The stored image is kept so the product can be restored; the purge
+	// job removes it together with the row
+	result := rt.requestDB(r).Where("version = ?", version).Delete(&models.Product{}, productID)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete product", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Product not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Product{}, productID, "Product")
 		return
 	}
 
@@ -970,7 +858,14 @@ func (rt *router) deleteProduct(w http.ResponseWriter, r *http.Request) {
 // Order CRUD handlers
 func (rt *router) getOrder(w http.ResponseWriter, r *http.Request) {
 	var orders []models.Order
-	result := rt.db.Find(&orders)
+	query, ok := withDeleted(w, r, rt.requestDB(r), middleware.PermManageOrders)
+	if !ok {
+		return
+	}
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		query = query.Where("user_id = ?", userID)
+	}
+	result := query.Order("created_at DESC").Find(&orders)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve orders", http.StatusInternalServerError)
 		return
@@ -998,8 +893,12 @@ func (rt *router) inputOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	order.CreatedAt = "2023-10-01"
-	result := rt.db.Create(&order)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		order.UserId = userID
+	}
+	order.Status = models.OrderStatusPending
+	order.CreatedAt = time.Now()
+	result := rt.requestDB(r).Create(&order)
 	if result.Error != nil {
 		http.Error(w, "Failed to create order", http.StatusInternalServerError)
 		return
@@ -1021,9 +920,13 @@ func (rt *router) inputOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) updateOrder(w http.ResponseWriter, r *http.Request) {
-	orderID := r.URL.Path[len("/orders/"):]
-	if orderID == "" {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+	orderID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -1032,18 +935,25 @@ func (rt *router) updateOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
+	// Status only changes through the transition endpoints and the total
+	// is derived from the order lines
+	order.Status = ""
+	order.Total = models.Money{}
 
-	result := rt.db.Model(&models.Order{}).Where("id = ?", orderID).Updates(order)
+	// The update only applies to the version the client read
+	order.Version = version + 1
+	result := rt.requestDB(r).Model(&models.Order{}).Where("id = ? AND version = ?", orderID, version).Updates(order)
 	if result.Error != nil {
 		http.Error(w, "Failed to update order", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Order{}, orderID, "Order")
 		return
 	}
 
+	w.Header().Set("ETag", etag(order.Version))
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"message": "Order updated successfully",
@@ -1059,20 +969,24 @@ func (rt *router) updateOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deleteOrder(w http.ResponseWriter, r *http.Request) {
-	orderID := r.URL.Path[len("/orders/"):]
-	if orderID == "" {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+	orderID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	result := rt.db.Delete(&models.Order{}, orderID)
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	result := rt.requestDB(r).Where("version = ?", version).Delete(&models.Order{}, orderID)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete order", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Order{}, orderID, "Order")
 		return
 	}
 
@@ -1093,7 +1007,11 @@ func (rt *router) deleteOrder(w http.ResponseWriter, r *http.Request) {
 // Repair CRUD handlers
 func (rt *router) getRepair(w http.ResponseWriter, r *http.Request) {
 	var repairs []models.Repair
-	result := rt.db.Find(&repairs)
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageRepairs); scoped {
+		query = query.Where("user_id = ?", userID)
+	}
+	result := query.Order("created_at DESC").Find(&repairs)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve repairs", http.StatusInternalServerError)
 		return
@@ -1122,9 +1040,12 @@ func (rt *router) inputRepair(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repair.CreatedAt = "2023-10-01"
-	repair.UpdatedAt = "2023-10-01"
-	result := rt.db.Create(&repair)
+	if userID, scoped := ownerScope(r, middleware.PermManageRepairs); scoped {
+		repair.UserId = userID
+	}
+	repair.CreatedAt = time.Now()
+	repair.UpdatedAt = time.Now()
+	result := rt.requestDB(r).Create(&repair)
 	if result.Error != nil {
 		http.Error(w, "Failed to create repair", http.StatusInternalServerError)
 		return
@@ -1146,9 +1067,13 @@ func (rt *router) inputRepair(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) updateRepair(w http.ResponseWriter, r *http.Request) {
-	repairID := r.URL.Path[len("/repairs/"):]
-	if repairID == "" {
-		http.Error(w, "Repair ID is required", http.StatusBadRequest)
+	repairID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -1158,18 +1083,21 @@ func (rt *router) updateRepair(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repair.UpdatedAt = "2023-10-01"
-	result := rt.db.Model(&models.Repair{}).Where("id = ?", repairID).Updates(repair)
+	repair.UpdatedAt = time.Now()
+	// The update only applies to the version the client read
+	repair.Version = version + 1
+	result := rt.requestDB(r).Model(&models.Repair{}).Where("id = ? AND version = ?", repairID, version).Updates(repair)
 	if result.Error != nil {
 		http.Error(w, "Failed to update repair", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Repair not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Repair{}, repairID, "Repair")
 		return
 	}
 
+	w.Header().Set("ETag", etag(repair.Version))
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"message": "Repair updated successfully",
@@ -1185,22 +1113,56 @@ func (rt *router) updateRepair(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deleteRepair(w http.ResponseWriter, r *http.Request) {
-	repairID := r.URL.Path[len("/repairs/"):]
-	if repairID == "" {
-		http.Error(w, "Repair ID is required", http.StatusBadRequest)
+	repairID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	result := rt.db.Delete(&models.Repair{}, repairID)
-	if result.Error != nil {
-		http.Error(w, "Failed to delete repair", http.StatusInternalServerError)
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		http.Error(w, "Repair not found", http.StatusNotFound)
+	// The repair's images go with it, their files once the rows are gone
+	errStale := errors.New("repair was changed")
+	var images []models.RepairImage
+	err := rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		// Lock the repair first so an image being attached either lands
+		// before the images are collected or finds the repair gone
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("version = ?", version).First(&models.Repair{}, repairID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errStale
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("repair_id = ?", repairID).Find(&images).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("repair_id = ?", repairID).Delete(&models.RepairImage{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("version = ?", version).Delete(&models.Repair{}, repairID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStale
+		}
+		return nil
+	})
+	if errors.Is(err, errStale) {
+		rt.preconditionFailed(w, r, &models.Repair{}, repairID, "Repair")
 		return
 	}
+	if err != nil {
+		http.Error(w, "Failed to delete repair", http.StatusInternalServerError)
+		return
+	}
+	for _, image := range images {
+		rt.storage.Delete(r.Context(), image.ImageKey)
+	}
 
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
@@ -1219,7 +1181,12 @@ func (rt *router) deleteRepair(w http.ResponseWriter, r *http.Request) {
 // RepairStatus CRUD handlers
 func (rt *router) getRepairStatus(w http.ResponseWriter, r *http.Request) {
 	var repairStatuses []models.RepairStatus
-	result := rt.db.Find(&repairStatuses)
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageRepairs); scoped {
+		query = query.Joins("JOIN repairs ON repairs.id = repair_statuses.repair_id").
+			Where("repairs.user_id = ?", userID)
+	}
+	result := query.Find(&repairStatuses)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve repair statuses", http.StatusInternalServerError)
 		return
@@ -1248,8 +1215,9 @@ func (rt *router) inputRepairStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repairStatus.UpdatedAt = "2023-10-01"
-	result := rt.db.Create(&repairStatus)
+	repairStatus.UpdatedBy = actor(r)
+	repairStatus.UpdatedAt = time.Now()
+	result := rt.requestDB(r).Create(&repairStatus)
 	if result.Error != nil {
 		http.Error(w, "Failed to create repair status", http.StatusInternalServerError)
 		return
@@ -1271,9 +1239,13 @@ func (rt *router) inputRepairStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) updateRepairStatus(w http.ResponseWriter, r *http.Request) {
-	statusID := r.URL.Path[len("/repair-statuses/"):]
-	if statusID == "" {
-		http.Error(w, "Repair Status ID is required", http.StatusBadRequest)
+	statusID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -1283,18 +1255,22 @@ func (rt *router) updateRepairStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repairStatus.UpdatedAt = "2023-10-01"
-	result := rt.db.Model(&models.RepairStatus{}).Where("id = ?", statusID).Updates(repairStatus)
+	repairStatus.UpdatedBy = actor(r)
+	repairStatus.UpdatedAt = time.Now()
+	// The update only applies to the version the client read
+	repairStatus.Version = version + 1
+	result := rt.requestDB(r).Model(&models.RepairStatus{}).Where("id = ? AND version = ?", statusID, version).Updates(repairStatus)
 	if result.Error != nil {
 		http.Error(w, "Failed to update repair status", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Repair status not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.RepairStatus{}, statusID, "Repair status")
 		return
 	}
 
+	w.Header().Set("ETag", etag(repairStatus.Version))
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"message": "Repair status updated successfully",
@@ -1310,20 +1286,24 @@ func (rt *router) updateRepairStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deleteRepairStatus(w http.ResponseWriter, r *http.Request) {
-	statusID := r.URL.Path[len("/repair-statuses/"):]
-	if statusID == "" {
-		http.Error(w, "Repair Status ID is required", http.StatusBadRequest)
+	statusID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	result := rt.db.Delete(&models.RepairStatus{}, statusID)
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	result := rt.requestDB(r).Where("version = ?", version).Delete(&models.RepairStatus{}, statusID)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete repair status", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Repair status not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.RepairStatus{}, statusID, "Repair status")
 		return
 	}
 
@@ -1344,7 +1324,7 @@ func (rt *router) deleteRepairStatus(w http.ResponseWriter, r *http.Request) {
 // ProductUpdateHistory CRUD handlers
 func (rt *router) getProductUpdateHistory(w http.ResponseWriter, r *http.Request) {
 	var histories []models.ProductUpdateHistory
-	result := rt.db.Find(&histories)
+	result := rt.requestDB(r).Find(&histories)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve product update histories", http.StatusInternalServerError)
 		return
@@ -1373,8 +1353,9 @@ func (rt *router) inputProductUpdateHistory(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	history.UpdatedAt = "2023-10-01"
-	result := rt.db.Create(&history)
+	history.AdminID = actor(r)
+	history.UpdatedAt = time.Now()
+	result := rt.requestDB(r).Create(&history)
 	if result.Error != nil {
 		http.Error(w, "Failed to create product update history", http.StatusInternalServerError)
 		return
@@ -1396,13 +1377,12 @@ func (rt *router) inputProductUpdateHistory(w http.ResponseWriter, r *http.Reque
 }
 
 func (rt *router) deleteProductUpdateHistory(w http.ResponseWriter, r *http.Request) {
-	historyID := r.URL.Path[len("/product-histories/"):]
-	if historyID == "" {
-		http.Error(w, "Product Update History ID is required", http.StatusBadRequest)
+	historyID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	result := rt.db.Delete(&models.ProductUpdateHistory{}, historyID)
+	result := rt.requestDB(r).Delete(&models.ProductUpdateHistory{}, historyID)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete product update history", http.StatusInternalServerError)
 		return
@@ -1430,7 +1410,12 @@ func (rt *router) deleteProductUpdateHistory(w http.ResponseWriter, r *http.Requ
 // Payment CRUD handlers
 func (rt *router) getPayment(w http.ResponseWriter, r *http.Request) {
 	var payments []models.Payment
-	result := rt.db.Find(&payments)
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		query = query.Joins("JOIN orders ON orders.id = payments.order_id AND orders.deleted_at IS NULL").
+			Where("orders.user_id = ?", userID)
+	}
+	result := query.Find(&payments)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve payments", http.StatusInternalServerError)
 		return
@@ -1459,10 +1444,13 @@ func (rt *router) inputPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payment.CreatedAt = "2023-10-01"
-	result := rt.db.Create(&payment)
-	if result.Error != nil {
-		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped && !rt.ownsOrder(payment.OrderID, userID) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	payment.CreatedAt = time.Now()
+	if err := rt.orders.WithContext(r.Context()).RecordPayment(&payment, actor(r)); err != nil {
+		writeOrderError(w, err, "Failed to create payment")
 		return
 	}
 
@@ -1482,9 +1470,13 @@ func (rt *router) inputPayment(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) updatePayment(w http.ResponseWriter, r *http.Request) {
-	paymentID := r.URL.Path[len("/payments/"):]
-	if paymentID == "" {
-		http.Error(w, "Payment ID is required", http.StatusBadRequest)
+	paymentID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -1494,17 +1486,20 @@ func (rt *router) updatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := rt.db.Model(&models.Payment{}).Where("id = ?", paymentID).Updates(payment)
-	if result.Error != nil {
-		http.Error(w, "Failed to update payment", http.StatusInternalServerError)
+	// Only the amount and type change, and the payment must still settle
+	// its order afterwards. The version is checked on the locked row.
+	updated, err := rt.orders.WithContext(r.Context()).UpdatePayment(uint(paymentID), version, payment.OrderID, payment.Amount, payment.Type)
+	if errors.Is(err, services.ErrStalePayment) {
+		rt.preconditionFailed(w, r, &models.Payment{}, paymentID, "Payment")
 		return
 	}
-
-	if result.RowsAffected == 0 {
-		http.Error(w, "Payment not found", http.StatusNotFound)
+	if err != nil {
+		writeOrderError(w, err, "Failed to update payment")
 		return
 	}
+	payment = *updated
 
+	w.Header().Set("ETag", etag(payment.Version))
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"message": "Payment updated successfully",
@@ -1520,20 +1515,24 @@ func (rt *router) updatePayment(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deletePayment(w http.ResponseWriter, r *http.Request) {
-	paymentID := r.URL.Path[len("/payments/"):]
-	if paymentID == "" {
-		http.Error(w, "Payment ID is required", http.StatusBadRequest)
+	paymentID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	result := rt.db.Delete(&models.Payment{}, paymentID)
-	if result.Error != nil {
-		http.Error(w, "Failed to delete payment", http.StatusInternalServerError)
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		http.Error(w, "Payment not found", http.StatusNotFound)
+	// Payments of paid orders stay; the order is refunded instead
+	err := rt.orders.WithContext(r.Context()).DeletePayment(uint(paymentID), version)
+	if errors.Is(err, services.ErrStalePayment) {
+		rt.preconditionFailed(w, r, &models.Payment{}, paymentID, "Payment")
+		return
+	}
+	if err != nil {
+		writeOrderError(w, err, "Failed to delete payment")
 		return
 	}
 
@@ -1554,7 +1553,12 @@ func (rt *router) deletePayment(w http.ResponseWriter, r *http.Request) {
 // Shipping CRUD handlers
 func (rt *router) getShipping(w http.ResponseWriter, r *http.Request) {
 	var shippings []models.Shipping
-	result := rt.db.Find(&shippings)
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		query = query.Joins("JOIN orders ON orders.id = shippings.order_id AND orders.deleted_at IS NULL").
+			Where("orders.user_id = ?", userID)
+	}
+	result := query.Find(&shippings)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve shippings", http.StatusInternalServerError)
 		return
@@ -1583,8 +1587,13 @@ func (rt *router) inputShipping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shipping.CreatedAt = "2023-10-01"
-	result := rt.db.Create(&shipping)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped && !rt.ownsOrder(shipping.OrderID, userID) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	shipping.CreatedAt = time.Now()
+	result := rt.requestDB(r).Create(&shipping)
 	if result.Error != nil {
 		http.Error(w, "Failed to create shipping", http.StatusInternalServerError)
 		return
@@ -1606,9 +1615,13 @@ func (rt *router) inputShipping(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) updateShipping(w http.ResponseWriter, r *http.Request) {
-	shippingID := r.URL.Path[len("/shippings/"):]
-	if shippingID == "" {
-		http.Error(w, "Shipping ID is required", http.StatusBadRequest)
+	shippingID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	version, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -1618,17 +1631,20 @@ func (rt *router) updateShipping(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := rt.db.Model(&models.Shipping{}).Where("id = ?", shippingID).Updates(shipping)
+	// The update only applies to the version the client read
+	shipping.Version = version + 1
+	result := rt.requestDB(r).Model(&models.Shipping{}).Where("id = ? AND version = ?", shippingID, version).Updates(shipping)
 	if result.Error != nil {
 		http.Error(w, "Failed to update shipping", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Shipping not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Shipping{}, shippingID, "Shipping")
 		return
 	}
 
+	w.Header().Set("ETag", etag(shipping.Version))
 	w.WriteHeader(http.StatusOK)
 	response := map[string]interface{}{
 		"message": "Shipping updated successfully",
@@ -1644,20 +1660,24 @@ func (rt *router) updateShipping(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deleteShipping(w http.ResponseWriter, r *http.Request) {
-	shippingID := r.URL.Path[len("/shippings/"):]
-	if shippingID == "" {
-		http.Error(w, "Shipping ID is required", http.StatusBadRequest)
+	shippingID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	result := rt.db.Delete(&models.Shipping{}, shippingID)
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	result := rt.requestDB(r).Where("version = ?", version).Delete(&models.Shipping{}, shippingID)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete shipping", http.StatusInternalServerError)
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		http.Error(w, "Shipping not found", http.StatusNotFound)
+		rt.preconditionFailed(w, r, &models.Shipping{}, shippingID, "Shipping")
 		return
 	}
 
@@ -1678,7 +1698,12 @@ func (rt *router) deleteShipping(w http.ResponseWriter, r *http.Request) {
 // ProductPerOrder CRUD handlers
 func (rt *router) getProductPerOrder(w http.ResponseWriter, r *http.Request) {
 	var productOrders []models.ProductPerOrder
-	result := rt.db.Find(&productOrders)
+	query := rt.requestDB(r)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped {
+		query = query.Joins("JOIN orders ON orders.id = product_per_orders.order_id AND orders.deleted_at IS NULL").
+			Where("orders.user_id = ?", userID)
+	}
+	result := query.Find(&productOrders)
 	if result.Error != nil {
 		http.Error(w, "Failed to retrieve product orders", http.StatusInternalServerError)
 		return
@@ -1707,10 +1732,20 @@ func (rt *router) inputProductPerOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	productOrder.CreatedAt = "2023-10-01"
-	result := rt.db.Create(&productOrder)
-	if result.Error != nil {
-		http.Error(w, "Failed to create product order", http.StatusInternalServerError)
+	if userID, scoped := ownerScope(r, middleware.PermManageOrders); scoped && !rt.ownsOrder(productOrder.OrderID, userID) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	// Only staff may discount a line; the price is always the product's own
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if !principal.Can(middleware.PermManageOrders) {
+		productOrder.Discount = models.Money{}
+	}
+	productOrder.CreatedAt = time.Now()
+	line, err := rt.orders.WithContext(r.Context()).AddLine(productOrder)
+	if err != nil {
+		writeOrderError(w, err, "Failed to create product order")
 		return
 	}
 
@@ -1718,7 +1753,7 @@ func (rt *router) inputProductPerOrder(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"message": "Product order created successfully",
 		"status":  "success",
-		"data":    productOrder,
+		"data":    line,
 	}
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
@@ -1730,20 +1765,13 @@ func (rt *router) inputProductPerOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (rt *router) deleteProductPerOrder(w http.ResponseWriter, r *http.Request) {
-	productOrderID := r.URL.Path[len("/product-orders/"):]
-	if productOrderID == "" {
-		http.Error(w, "Product Order ID is required", http.StatusBadRequest)
-		return
-	}
-
-	result := rt.db.Delete(&models.ProductPerOrder{}, productOrderID)
-	if result.Error != nil {
-		http.Error(w, "Failed to delete product order", http.StatusInternalServerError)
+	productOrderID, ok := IntParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		http.Error(w, "Product order not found", http.StatusNotFound)
+	if err := rt.orders.WithContext(r.Context()).RemoveLine(productOrderID); err != nil {
+		writeOrderError(w, err, "Failed to delete product order")
 		return
 	}
 
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"net/http"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// withDeleted applies the ?include_deleted flag to a list query. Only
+// callers holding the manage permission may ask for soft deleted rows;
+// anyone else gets a 403 and ok is false.
+func withDeleted(w http.ResponseWriter, r *http.Request, query *gorm.DB, manage middleware.Permission) (*gorm.DB, bool) {
+	values, present := r.URL.Query()["include_deleted"]
+	if !present {
+		return query, true
+	}
+
+	include := true
+	if values[0] != "" {
+		var err error
+		if include, err = strconv.ParseBool(values[0]); err != nil {
+			http.Error(w, "Invalid include_deleted flag", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	if !include {
+		return query, true
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	if !principal.Can(manage) {
+		http.Error(w, "Insufficient permissions to list deleted records", http.StatusForbidden)
+		return nil, false
+	}
+	return query.Unscoped(), true
+}
+
+// restore clears deleted_at on the soft deleted row of model named by the
+// id parameter and bumps its version
+func (rt *router) restore(w http.ResponseWriter, r *http.Request, model interface{}, name string) {
+	id, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	result := rt.requestDB(r).Unscoped().Model(model).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		http.Error(w, "Failed to restore "+name, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, name+" not found or not deleted", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": name + " restored successfully",
+		"status":  "success",
+	})
+}
+
+func (rt *router) restoreBrand(w http.ResponseWriter, r *http.Request) {
+	rt.restore(w, r, &models.Brand{}, "Brand")
+}
+
+func (rt *router) restoreCategory(w http.ResponseWriter, r *http.Request) {
+	rt.restore(w, r, &models.Category{}, "Category")
+}
+
+func (rt *router) restoreProduct(w http.ResponseWriter, r *http.Request) {
+	rt.restore(w, r, &models.Product{}, "Product")
+}
+
+func (rt *router) restoreOrder(w http.ResponseWriter, r *http.Request) {
+	rt.restore(w, r, &models.Order{}, "Order")
+}
+
+// unscoped is a preload condition that also loads soft deleted associations
+func unscoped(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// orderByID is a preload condition that keeps associations in creation order
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// node is one path segment in the routing tree. Children are tried in a fixed
+// order on lookup: static segments first, then a :param, then a *catchAll.
+type node struct {
+	static   map[string]*node
+	param    *node
+	catchAll *node
+
+	// name is the parameter name for :param and *catchAll nodes
+	name string
+
+	pattern  string
+	handlers map[string]http.HandlerFunc
+}
+
+func newNode() *node {
+	return &node{static: make(map[string]*node)}
+}
+
+// insert registers handler for method under pattern, creating nodes as needed.
+// Conflicting parameter names at the same position panic at registration time.
+func (n *node) insert(method, pattern string, handler http.HandlerFunc) {
+	segments := splitPath(pattern)
+	current := n
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name := segment[1:]
+			if name == "" {
+				panic("routes: empty parameter name in " + pattern)
+			}
+			if current.param == nil {
+				current.param = newNode()
+				current.param.name = name
+			} else if current.param.name != name {
+				panic("routes: parameter :" + name + " in " + pattern + " conflicts with :" + current.param.name)
+			}
+			current = current.param
+		case strings.HasPrefix(segment, "*"):
+			name := segment[1:]
+			if name == "" {
+				panic("routes: empty catch-all name in " + pattern)
+			}
+			if i != len(segments)-1 {
+				panic("routes: catch-all *" + name + " must be the last segment in " + pattern)
+			}
+			if current.catchAll == nil {
+				current.catchAll = newNode()
+				current.catchAll.name = name
+			} else if current.catchAll.name != name {
+				panic("routes: catch-all *" + name + " in " + pattern + " conflicts with *" + current.catchAll.name)
+			}
+			current = current.catchAll
+		default:
+			child, ok := current.static[segment]
+			if !ok {
+				child = newNode()
+				current.static[segment] = child
+			}
+			current = child
+		}
+	}
+
+	if current.handlers == nil {
+		current.handlers = make(map[string]http.HandlerFunc)
+	}
+	if _, exists := current.handlers[method]; exists {
+		panic("routes: duplicate route " + method + " " + pattern)
+	}
+	current.pattern = pattern
+	current.handlers[method] = handler
+}
+
+// lookup finds the node registered for the given path segments, preferring
+// static matches over parameters and parameters over catch-alls. Captured
+// parameter values are written into p.
+func (n *node) lookup(segments []string, p params) *node {
+	if len(segments) == 0 {
+		if n.handlers != nil {
+			return n
+		}
+		// A catch-all also matches an empty remainder
+		if n.catchAll != nil && n.catchAll.handlers != nil {
+			p[n.catchAll.name] = ""
+			return n.catchAll
+		}
+		return nil
+	}
+
+	segment := segments[0]
+	if child, ok := n.static[segment]; ok {
+		if found := child.lookup(segments[1:], p); found != nil {
+			return found
+		}
+	}
+
+	if n.param != nil && segment != "" {
+		if found := n.param.lookup(segments[1:], p); found != nil {
+			p[n.param.name] = segment
+			return found
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.handlers != nil {
+		p[n.catchAll.name] = strings.Join(segments, "/")
+		return n.catchAll
+	}
+
+	return nil
+}
+
+// allowed lists the methods registered on the node, including the implicit
+// HEAD and OPTIONS answered by the router
+func (n *node) allowed() string {
+	methods := make([]string, 0, len(n.handlers)+2)
+	for method := range n.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := n.handlers[http.MethodGet]; ok {
+		if _, ok := n.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	if _, ok := n.handlers[http.MethodOptions]; !ok {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
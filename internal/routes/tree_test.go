@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterMatching(t *testing.T) {
+	r := newBareRouter()
+	route := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Route", name)
+			w.Header().Set("X-Params", Param(req, "id")+"|"+Param(req, "path"))
+			w.Write([]byte(name))
+		}
+	}
+	r.AddRoute(http.MethodGet, "/", route("root"))
+	r.AddRoute(http.MethodGet, "/products", route("list"))
+	r.AddRoute(http.MethodPost, "/products", route("create"))
+	r.AddRoute(http.MethodGet, "/products/new", route("static"))
+	r.AddRoute(http.MethodGet, "/products/:id", route("param"))
+	r.AddRoute(http.MethodPut, "/products/:id", route("update"))
+	r.AddRoute(http.MethodGet, "/products/:id/images", route("images"))
+	r.AddRoute(http.MethodGet, "/files/*path", route("files"))
+	r.AddRoute(http.MethodGet, "/files/readme", route("readme"))
+
+	tests := []struct {
+		method, path string
+		status       int
+		route        string
+		params       string
+		allow        string
+	}{
+		{http.MethodGet, "/", http.StatusOK, "root", "|", ""},
+		{http.MethodGet, "/products", http.StatusOK, "list", "|", ""},
+		{http.MethodGet, "/products/", http.StatusOK, "list", "|", ""},
+		{http.MethodPost, "/products", http.StatusOK, "create", "|", ""},
+		// Static segments win over parameters, whatever the registration order
+		{http.MethodGet, "/products/new", http.StatusOK, "static", "|", ""},
+		{http.MethodGet, "/products/7", http.StatusOK, "param", "7|", ""},
+		{http.MethodGet, "/products/7/images", http.StatusOK, "images", "7|", ""},
+		{http.MethodGet, "/products/new/images", http.StatusOK, "images", "new|", ""},
+		{http.MethodGet, "/files/readme", http.StatusOK, "readme", "|", ""},
+		{http.MethodGet, "/files/a/b/c.png", http.StatusOK, "files", "|a/b/c.png", ""},
+		{http.MethodGet, "/files", http.StatusOK, "files", "|", ""},
+		{http.MethodGet, "/missing", http.StatusNotFound, "", "", ""},
+		{http.MethodGet, "/products/7/missing", http.StatusNotFound, "", "", ""},
+		{http.MethodDelete, "/products/7", http.StatusMethodNotAllowed, "", "", "GET, HEAD, OPTIONS, PUT"},
+		{http.MethodPut, "/products", http.StatusMethodNotAllowed, "", "", "GET, HEAD, OPTIONS, POST"},
+		{http.MethodOptions, "/products/7", http.StatusNoContent, "", "", "GET, HEAD, OPTIONS, PUT"},
+		{http.MethodHead, "/products/7", http.StatusOK, "param", "7|", ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+			continue
+		}
+		if route := rec.Header().Get("X-Route"); route != tt.route {
+			t.Errorf("%s %s: matched %q, want %q", tt.method, tt.path, route, tt.route)
+		}
+		if params := rec.Header().Get("X-Params"); tt.route != "" && params != tt.params {
+			t.Errorf("%s %s: params = %q, want %q", tt.method, tt.path, params, tt.params)
+		}
+		if allow := rec.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s: Allow = %q, want %q", tt.method, tt.path, allow, tt.allow)
+		}
+	}
+}
+
+func TestRouterRejectsConflictingRoutes(t *testing.T) {
+	handler := func(http.ResponseWriter, *http.Request) {}
+	tests := []struct {
+		name     string
+		existing string
+		pattern  string
+	}{
+		{"duplicate route", "/products/:id", "/products/:id"},
+		{"parameter renamed", "/products/:id", "/products/:productId/images"},
+		{"catch-all renamed", "/files/*path", "/files/*rest"},
+		{"catch-all not last", "", "/files/*path/edit"},
+		{"empty parameter name", "", "/products/:"},
+		{"empty catch-all name", "", "/files/*"},
+	}
+	for _, tt := range tests {
+		r := newBareRouter()
+		if tt.existing != "" {
+			r.AddRoute(http.MethodGet, tt.existing, handler)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: registering %s did not panic", tt.name, tt.pattern)
+				}
+			}()
+			r.AddRoute(http.MethodGet, tt.pattern, handler)
+		}()
+	}
+}
@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"go_boilerplate/internal/services"
+	"net/http"
+)
+
+type credentials struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// writeAuthError reports an auth service error. Known errors are safe to
+// show to the client; anything else becomes a generic 500.
+func writeAuthError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrWeakPassword),
+		errors.Is(err, services.ErrInvalidRole):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidCredentials),
+		errors.Is(err, services.ErrInvalidRefreshToken),
+		errors.Is(err, services.ErrRefreshTokenReused):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+func (rt *router) register(w http.ResponseWriter, r *http.Request) {
+	var input credentials
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Self registration always creates a customer account
+	user, err := rt.auth.Register(input.Email, input.Name, input.Password, middleware.RoleCustomer)
+	if err != nil {
+		writeAuthError(w, err, "Failed to register user")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "User registered successfully",
+		"status":  "success",
+		"data":    user,
+	})
+}
+
+func (rt *router) login(w http.ResponseWriter, r *http.Request) {
+	var input credentials
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := rt.auth.Login(input.Email, input.Password)
+	if err != nil {
+		writeAuthError(w, err, "Failed to log in")
+		return
+	}
+	writeTokens(w, tokens)
+}
+
+func (rt *router) refresh(w http.ResponseWriter, r *http.Request) {
+	var input refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := rt.auth.Refresh(input.RefreshToken)
+	if err != nil {
+		writeAuthError(w, err, "Failed to refresh token")
+		return
+	}
+	writeTokens(w, tokens)
+}
+
+func (rt *router) logout(w http.ResponseWriter, r *http.Request) {
+	var input refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.auth.Logout(input.RefreshToken); err != nil && !errors.Is(err, services.ErrInvalidRefreshToken) {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Logged out successfully",
+		"status":  "success",
+	})
+}
+
+func writeTokens(w http.ResponseWriter, tokens *services.TokenPair) {
+	// Tokens must never be cached by intermediaries
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"data":   tokens,
+	})
+}
+
+func (rt *router) getMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := actorID(r)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var user models.User
+	if err := rt.requestDB(r).First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   user,
+		"status": "success",
+	})
+}
+
+// User management handlers
+func (rt *router) getUser(w http.ResponseWriter, r *http.Request) {
+	var users []models.User
+	result := rt.requestDB(r).Find(&users)
+	if result.Error != nil {
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":   users,
+		"status": "success",
+		"count":  len(users),
+	})
+}
+
+func (rt *router) inputUser(w http.ResponseWriter, r *http.Request) {
+	var input credentials
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if input.Role == "" {
+		input.Role = middleware.RoleCustomer
+	}
+
+	user, err := rt.auth.Register(input.Email, input.Name, input.Password, input.Role)
+	if err != nil {
+		writeAuthError(w, err, "Failed to create user")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "User created successfully",
+		"status":  "success",
+		"data":    user,
+	})
+}
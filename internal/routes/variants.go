@@ -0,0 +1,312 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"go_boilerplate/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// variantForm is the multipart form a variant is created or updated from
+type variantForm struct {
+	SKU     string
+	Options models.VariantOptions
+	Price   models.Money
+}
+
+// parseVariantForm reads the SKU, the options as a JSON object such as
+// {"color": "black", "storage": "256GB"} and the price. ok is false when
+// an error response was written.
+func parseVariantForm(w http.ResponseWriter, r *http.Request) (variantForm, bool) {
+	var form variantForm
+	form.SKU = strings.TrimSpace(r.FormValue("sku"))
+	if form.SKU == "" {
+		http.Error(w, "SKU is required", http.StatusBadRequest)
+		return form, false
+	}
+	if options := r.FormValue("options"); options != "" {
+		if err := json.Unmarshal([]byte(options), &form.Options); err != nil {
+			http.Error(w, "Options must be a JSON object of strings", http.StatusBadRequest)
+			return form, false
+		}
+	}
+	price, err := models.ParseMoney(r.FormValue("price"), r.FormValue("currency"))
+	if err != nil {
+		http.Error(w, "Invalid price: "+err.Error(), http.StatusBadRequest)
+		return form, false
+	}
+	form.Price = price
+	return form, true
+}
+
+// storeVariantImage processes and saves the optional image field under
+// the product's variant prefix. The upload is empty when no image was
+// sent. Variant images are validated and stripped like product images but
+// have no renditions.
+func (rt *router) storeVariantImage(w http.ResponseWriter, r *http.Request, productID uint) (imageUpload, bool) {
+	file, header, err := r.FormFile("image")
+	if errors.Is(err, http.ErrMissingFile) {
+		return imageUpload{}, true
+	}
+	if err != nil {
+		http.Error(w, "Failed to parse form file", http.StatusBadRequest)
+		return imageUpload{}, false
+	}
+	file.Close()
+
+	upload, err := rt.processUpload(header, nil)
+	if err == nil {
+		err = rt.storeUpload(r, variantImagePrefix(productID), &upload)
+	}
+	if err != nil {
+		writeUploadError(w, err)
+		return imageUpload{}, false
+	}
+	return upload, true
+}
+
+// releaseVariantImage deletes a variant image that is no longer used.
+// Variants of a product that were given the same file share its object, so
+// it stays while any variant, deleted or not, still refers to it.
+func (rt *router) releaseVariantImage(r *http.Request, key string) {
+	var count int64
+	err := rt.requestDB(r).Unscoped().Model(&models.ProductVariant{}).
+		Where("image_key = ?", key).Count(&count).Error
+	if err == nil && count == 0 {
+		rt.storage.Delete(r.Context(), key)
+	}
+}
+
+// skuTaken reports whether another variant, deleted or not, uses sku
+func (rt *router) skuTaken(r *http.Request, sku string, variantID uint) (bool, error) {
+	var count int64
+	err := rt.requestDB(r).Unscoped().Model(&models.ProductVariant{}).
+		Where("sku = ? AND id <> ?", sku, variantID).Count(&count).Error
+	return count > 0, err
+}
+
+// findProductVariant loads the variant named by the variantId parameter of
+// the product named by the id parameter
+func (rt *router) findProductVariant(w http.ResponseWriter, r *http.Request) (models.ProductVariant, bool) {
+	var variant models.ProductVariant
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return variant, false
+	}
+	variantID, ok := IntParam(w, r, "variantId")
+	if !ok {
+		return variant, false
+	}
+
+	err := rt.requestDB(r).Where("product_id = ?", productID).First(&variant, variantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product variant not found", http.StatusNotFound)
+		return variant, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve product variant", http.StatusInternalServerError)
+		return variant, false
+	}
+	return variant, true
+}
+
+func (rt *router) getVariantByID(w http.ResponseWriter, r *http.Request) {
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	variantID, ok := IntParam(w, r, "variantId")
+	if !ok {
+		return
+	}
+	query := rt.requestDB(r).Where("product_id = ?", productID)
+	rt.writeVersioned(w, query, &models.ProductVariant{}, variantID, "Product variant")
+}
+
+// inputVariant adds a variant to a product. Its initial stock is booked
+// through the ledger like a product's.
+func (rt *router) inputVariant(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(10 << 20)
+	productID, ok := IntParam(w, r, "id")
+	if !ok {
+		return
+	}
+	form, ok := parseVariantForm(w, r)
+	if !ok {
+		return
+	}
+	stock := 0
+	if value := r.FormValue("stock"); value != "" {
+		var err error
+		if stock, err = strconv.Atoi(value); err != nil || stock < 0 {
+			http.Error(w, "Invalid stock", http.StatusBadRequest)
+			return
+		}
+	}
+	upload, ok := rt.storeVariantImage(w, r, productID)
+	if !ok {
+		return
+	}
+
+	variant, err := rt.inventory.WithContext(r.Context()).CreateVariant(models.ProductVariant{
+		ProductID: productID,
+		SKU:       form.SKU,
+		Options:   form.Options,
+		Price:     form.Price,
+		ImageKey:  upload.image.ImageKey,
+		ImageName: upload.image.OriginalName,
+	}, stock, actor(r))
+	if err != nil {
+		rt.discardUploads(r, []imageUpload{upload})
+		writeInventoryError(w, err, "Failed to create product variant")
+		return
+	}
+	rt.resolveVariantImageURL(variant)
+
+	w.Header().Set("ETag", etag(variant.Version))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Product variant created successfully",
+		"status":  "success",
+		"data":    variant,
+	})
+}
+
+func (rt *router) updateVariant(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(10 << 20)
+	variant, ok := rt.findProductVariant(w, r)
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	if variant.Version != version {
+		rt.preconditionFailed(w, r, &models.ProductVariant{}, variant.ID, "Product variant")
+		return
+	}
+	form, ok := parseVariantForm(w, r)
+	if !ok {
+		return
+	}
+	taken, err := rt.skuTaken(r, form.SKU, variant.ID)
+	if err != nil {
+		http.Error(w, "Failed to update product variant", http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, "SKU is already in use: "+form.SKU, http.StatusConflict)
+		return
+	}
+
+	stock := r.FormValue("stock")
+	onHand := 0
+	if stock != "" {
+		if onHand, err = strconv.Atoi(stock); err != nil || onHand < 0 {
+			http.Error(w, "Invalid stock", http.StatusBadRequest)
+			return
+		}
+	}
+
+	upload, ok := rt.storeVariantImage(w, r, variant.ProductID)
+	if !ok {
+		return
+	}
+	imageKey, imageName := upload.image.ImageKey, upload.image.OriginalName
+	if imageKey == "" {
+		imageKey, imageName = variant.ImageKey, variant.ImageName
+	}
+
+	// As with products, a new stock figure is booked as a ledger adjustment
+	// after the version checked update and bumps the version once more
+	errStale := errors.New("product variant was changed")
+	err = rt.requestDB(r).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ProductVariant{}).Where("id = ? AND version = ?", variant.ID, version).Updates(map[string]interface{}{
+			"version":        version + 1,
+			"sku":            form.SKU,
+			"options":        form.Options,
+			"price_minor":    form.Price.Amount,
+			"price_currency": form.Price.Currency,
+			"image_key":      imageKey,
+			"image_name":     imageName,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStale
+		}
+		version++
+		if stock == "" {
+			return nil
+		}
+		movement, err := rt.inventory.WithTx(tx).
+			SetStock(variant.ProductID, &variant.ID, onHand, actor(r), "variant update")
+		if err != nil {
+			return err
+		}
+		if movement != nil {
+			version++
+		}
+		return nil
+	})
+	if err != nil {
+		rt.discardUploads(r, []imageUpload{upload})
+		if errors.Is(err, errStale) {
+			rt.preconditionFailed(w, r, &models.ProductVariant{}, variant.ID, "Product variant")
+		} else {
+			writeInventoryError(w, err, "Failed to update product variant")
+		}
+		return
+	}
+	if imageKey != variant.ImageKey && variant.ImageKey != "" {
+		rt.releaseVariantImage(r, variant.ImageKey)
+	}
+
+	w.Header().Set("ETag", etag(version))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Product variant updated successfully",
+		"status":  "success",
+	})
+}
+
+// deleteVariant soft deletes a variant. Its stock has to be taken to zero
+// through the ledger first, so the product's stock stays the sum of its
+// live variants.
+func (rt *router) deleteVariant(w http.ResponseWriter, r *http.Request) {
+	variant, ok := rt.findProductVariant(w, r)
+	if !ok {
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	if variant.Version != version {
+		rt.preconditionFailed(w, r, &models.ProductVariant{}, variant.ID, "Product variant")
+		return
+	}
+	if variant.Stock != 0 {
+		http.Error(w, "Product variant still has stock on hand, set its stock to zero first", http.StatusConflict)
+		return
+	}
+
+	result := rt.requestDB(r).Where("version = ? AND stock = 0", version).Delete(&models.ProductVariant{}, variant.ID)
+	if result.Error != nil {
+		http.Error(w, "Failed to delete product variant", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		rt.preconditionFailed(w, r, &models.ProductVariant{}, variant.ID, "Product variant")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message": "Product variant deleted successfully",
+		"status":  "success",
+	})
+}
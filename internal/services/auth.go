@@ -0,0 +1,273 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrEmailTaken          = errors.New("email is already registered")
+	ErrInvalidEmail        = errors.New("email is invalid")
+	ErrWeakPassword        = errors.New("password must be at least 8 characters")
+	ErrInvalidRole         = errors.New("role is invalid")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// TokenSigner issues access tokens that JWTAuth accepts
+type TokenSigner struct {
+	Method   jwt.SigningMethod
+	Key      interface{}
+	KID      string
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+}
+
+// Sign returns a signed access token for the user and its expiry time
+func (signer TokenSigner) Sign(user models.User) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(signer.TTL)
+	claims := middleware.Claims{
+		Roles: []string{user.Role},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Issuer:    signer.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	if signer.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{signer.Audience}
+	}
+
+	token := jwt.NewWithClaims(signer.Method, claims)
+	if signer.KID != "" {
+		token.Header["kid"] = signer.KID
+	}
+	signed, err := token.SignedString(signer.Key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// TokenPair is returned by login and refresh
+type TokenPair struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	TokenType    string    `json:"tokenType"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+type AuthService struct {
+	db         *gorm.DB
+	signer     TokenSigner
+	refreshTTL time.Duration
+}
+
+func NewAuthService(db *gorm.DB, signer TokenSigner, refreshTTL time.Duration) *AuthService {
+	return &AuthService{
+		db:         db,
+		signer:     signer,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// dummyHash is compared against when the email is unknown so that login
+// takes the same time whether or not the account exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// Register creates a user with a bcrypt hashed password
+func (s *AuthService) Register(email, name, password, role string) (*models.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return nil, ErrInvalidEmail
+	}
+	if len(password) < 8 {
+		return nil, ErrWeakPassword
+	}
+	switch role {
+	case middleware.RoleAdmin, middleware.RoleStaff, middleware.RoleTechnician, middleware.RoleCustomer:
+	default:
+		return nil, ErrInvalidRole
+	}
+
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrEmailTaken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := models.User{
+		Email:        email,
+		Name:         name,
+		PasswordHash: string(hash),
+		Role:         role,
+	}
+	if err := s.db.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login checks the credentials and starts a new refresh token family
+func (s *AuthService) Login(email, password string) (*TokenPair, error) {
+	var user models.User
+	err := s.db.Where("email = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	var pair *TokenPair
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var issueErr error
+		pair, _, issueErr = s.issue(tx, user, familyID)
+		return issueErr
+	})
+	return pair, err
+}
+
+// Refresh rotates a refresh token. Presenting a token that was already
+// rotated is treated as theft and revokes every token in its family.
+func (s *AuthService) Refresh(refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	reused := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if stored.RevokedAt != nil {
+			reused = true
+			return nil
+		}
+		if now.After(stored.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		var user models.User
+		if err := tx.First(&user, stored.UserID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		var nextID uint
+		pair, nextID, err = s.issue(tx, user, stored.FamilyID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&stored).Updates(map[string]interface{}{
+			"revoked_at":  now,
+			"replaced_by": nextID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		if err := s.Logout(refreshToken); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// Logout revokes every refresh token in the presented token's family
+func (s *AuthService) Logout(refreshToken string) error {
+	var stored models.RefreshToken
+	err := s.db.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", stored.FamilyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// issue signs an access token and stores a new refresh token in the family
+func (s *AuthService) issue(tx *gorm.DB, user models.User, familyID string) (*TokenPair, uint, error) {
+	accessToken, expiresAt, err := s.signer.Sign(user)
+	if err != nil {
+		return nil, 0, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	stored := models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}, stored.ID, nil
+}
+
+// randomToken returns n random bytes encoded as URL safe base64
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken returns the hex SHA-256 of a refresh token; only hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"go_boilerplate/internal/middleware"
+	"go_boilerplate/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+func newAuthService(t *testing.T, refreshTTL time.Duration) (*AuthService, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}); err != nil {
+		t.Fatal(err)
+	}
+	signer := TokenSigner{Method: jwt.SigningMethodHS256, Key: []byte("secret"), TTL: time.Minute}
+	return NewAuthService(db, signer, refreshTTL), db
+}
+
+// authenticate runs a request with the access token through JWTAuth and
+// returns the status and the principal it stored
+func authenticate(config middleware.JWTConfig, accessToken string) (int, *middleware.Principal) {
+	var principal *middleware.Principal
+	handler := middleware.JWTAuth(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = middleware.PrincipalFromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code, principal
+}
+
+func TestRegister(t *testing.T) {
+	auth, db := newAuthService(t, time.Hour)
+	if _, err := auth.Register("Ann@Example.com ", "Ann", "correct horse", middleware.RoleCustomer); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, email, password, role string
+		err                         error
+	}{
+		{"email without @", "ann.example.com", "correct horse", middleware.RoleCustomer, ErrInvalidEmail},
+		{"short password", "bob@example.com", "short", middleware.RoleCustomer, ErrWeakPassword},
+		{"unknown role", "bob@example.com", "correct horse", "owner", ErrInvalidRole},
+		{"email taken in another case", "ANN@example.com", "correct horse", middleware.RoleCustomer, ErrEmailTaken},
+	}
+	for _, tt := range tests {
+		if _, err := auth.Register(tt.email, tt.name, tt.password, tt.role); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	var user models.User
+	if err := db.First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "ann@example.com" || user.PasswordHash == "" || user.PasswordHash == "correct horse" {
+		t.Errorf("stored user = %+v, want a normalised email and a password hash", user)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	auth, _ := newAuthService(t, time.Hour)
+	user, err := auth.Register("ann@example.com", "Ann", "correct horse", middleware.RoleStaff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, email, password string
+		err                   error
+	}{
+		{"wrong password", "ann@example.com", "wrong horse", ErrInvalidCredentials},
+		{"unknown email", "bob@example.com", "correct horse", ErrInvalidCredentials},
+		{"email in another case", " ANN@example.com", "correct horse", nil},
+	}
+	for _, tt := range tests {
+		if _, err := auth.Login(tt.email, tt.password); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	pair, err := auth.Login("ann@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, principal := authenticate(middleware.JWTConfig{HMACKeys: map[string][]byte{"": []byte("secret")}}, pair.AccessToken)
+	if status != http.StatusOK || principal.Subject != strconv.FormatUint(uint64(user.ID), 10) || !principal.HasRole(middleware.RoleStaff) {
+		t.Errorf("access token for user %d gave %d with %+v", user.ID, status, principal)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	auth, _ := newAuthService(t, time.Hour)
+	if _, err := auth.Register("ann@example.com", "Ann", "correct horse", middleware.RoleCustomer); err != nil {
+		t.Fatal(err)
+	}
+	first, err := auth.Login("ann@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := auth.Login("ann@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := auth.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh returned the same refresh token")
+	}
+
+	// Presenting the rotated token again revokes its whole family, but
+	// not the tokens of another login
+	if _, err := auth.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("reusing a rotated token error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, err := auth.Refresh(second.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("refreshing a revoked family error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if _, err := auth.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("refreshing another login error = %v, want none", err)
+	}
+	if _, err := auth.Refresh("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	expired, _ := newAuthService(t, -time.Minute)
+	if _, err := expired.Register("bob@example.com", "Bob", "correct horse", middleware.RoleCustomer); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := expired.Login("bob@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expired.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired token error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	auth, _ := newAuthService(t, time.Hour)
+	if _, err := auth.Register("ann@example.com", "Ann", "correct horse", middleware.RoleCustomer); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := auth.Login("ann@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.Logout(pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Refresh(pair.RefreshToken); err == nil {
+		t.Error("refreshing after logout succeeded")
+	}
+	if err := auth.Logout("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("logging out an unknown token error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestTokenSignerKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: 7, Role: middleware.RoleTechnician}
+	sign := func(signer TokenSigner) string {
+		signer.Issuer, signer.Audience, signer.TTL = "api", "shop", time.Minute
+		token, _, err := signer.Sign(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	oldToken := sign(TokenSigner{Method: jwt.SigningMethodHS256, Key: []byte("old"), KID: "2025"})
+	newToken := sign(TokenSigner{Method: jwt.SigningMethodHS256, Key: []byte("new"), KID: "2026"})
+	rsaToken := sign(TokenSigner{Method: jwt.SigningMethodRS256, Key: rsaKey, KID: "rsa-1"})
+
+	rotating := middleware.JWTConfig{
+		HMACKeys: map[string][]byte{"2025": []byte("old"), "2026": []byte("new")},
+		RSAKeys:  map[string]*rsa.PublicKey{"rsa-1": &rsaKey.PublicKey},
+		Issuer:   "api",
+		Audience: "shop",
+	}
+	rotated := rotating
+	rotated.HMACKeys = map[string][]byte{"2026": []byte("new")}
+
+	tests := []struct {
+		name   string
+		config middleware.JWTConfig
+		token  string
+		status int
+	}{
+		{"old key during rotation", rotating, oldToken, http.StatusOK},
+		{"new key during rotation", rotating, newToken, http.StatusOK},
+		{"RSA key", rotating, rsaToken, http.StatusOK},
+		{"old key after rotation", rotated, oldToken, http.StatusUnauthorized},
+		{"new key after rotation", rotated, newToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		status, principal := authenticate(tt.config, tt.token)
+		if status != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.status)
+			continue
+		}
+		if status == http.StatusOK && (principal.Subject != "7" || !principal.HasRole(middleware.RoleTechnician)) {
+			t.Errorf("%s: principal = %+v, want user 7 as a technician", tt.name, principal)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrEmptyCart           = errors.New("checkout needs at least one item")
+	ErrInvalidQuantity     = errors.New("item quantity must be positive")
+	ErrAddressRequired     = errors.New("shipping address is required")
+	ErrPaymentTypeRequired = errors.New("payment type is required")
+)
+
+// Reasons an item cannot be checked out
+const (
+	ReasonNotFound          = "not_found"
+	ReasonInsufficientStock = "insufficient_stock"
+	ReasonVariantRequired   = "variant_required"
+)
+
+// CheckoutItem is one product, or one variant of it, and how many to buy
+type CheckoutItem struct {
+	ProductID uint  `json:"productId"`
+	VariantID *uint `json:"variantId,omitempty"`
+	Quantity  int   `json:"quantity"`
+}
+
+// checkoutKey identifies what an item buys; variantID is zero for
+// products sold without variants
+type checkoutKey struct {
+	productID uint
+	variantID uint
+}
+
+func (k checkoutKey) variant() *uint {
+	if k.variantID == 0 {
+		return nil
+	}
+	variantID := k.variantID
+	return &variantID
+}
+
+// CheckoutInput describes a complete order placed in one request
+type CheckoutInput struct {
+	UserID      uint
+	Items       []CheckoutItem
+	Address     string
+	PaymentType string
+	Actor       string // Recorded as whoever paid the order
+}
+
+// UnavailableItem explains why an item could not be checked out
+type UnavailableItem struct {
+	ProductID uint   `json:"productId"`
+	VariantID *uint  `json:"variantId,omitempty"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+	Reason    string `json:"reason"`
+}
+
+// UnavailableError lists every item that stopped a checkout
+type UnavailableError struct {
+	Items []UnavailableItem
+}
+
+func (e *UnavailableError) Error() string {
+	ids := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		ids[i] = fmt.Sprint(item.ProductID)
+		if item.VariantID != nil {
+			ids[i] += fmt.Sprintf(" (variant %d)", *item.VariantID)
+		}
+	}
+	return "unavailable products: " + strings.Join(ids, ", ")
+}
+
+// Checkout places an order in a single transaction: it locks the products,
+// reserves their available stock, and creates the order with its lines,
+// shipping and payment at the current prices. The payment settles the
+// order, so it is marked paid and its reservations converted. Nothing is
+// written when any item is unavailable.
+func (s *OrderService) Checkout(input CheckoutInput) (*models.Order, error) {
+	if len(input.Items) == 0 {
+		return nil, ErrEmptyCart
+	}
+	if strings.TrimSpace(input.Address) == "" {
+		return nil, ErrAddressRequired
+	}
+	if strings.TrimSpace(input.PaymentType) == "" {
+		return nil, ErrPaymentTypeRequired
+	}
+
+	// Merge repeated items so each is checked against its stock once
+	quantities := make(map[checkoutKey]int)
+	for _, item := range input.Items {
+		if item.Quantity <= 0 {
+			return nil, ErrInvalidQuantity
+		}
+		key := checkoutKey{productID: item.ProductID}
+		if item.VariantID != nil {
+			key.variantID = *item.VariantID
+		}
+		quantities[key] += item.Quantity
+	}
+	keys := make([]checkoutKey, 0, len(quantities))
+	var productIDs, variantIDs []uint
+	for key := range quantities {
+		keys = append(keys, key)
+		productIDs = append(productIDs, key.productID)
+		if key.variantID != 0 {
+			variantIDs = append(variantIDs, key.variantID)
+		}
+	}
+	slices.SortFunc(keys, func(a, b checkoutKey) int {
+		if a.productID != b.productID {
+			return cmp.Compare(a.productID, b.productID)
+		}
+		return cmp.Compare(a.variantID, b.variantID)
+	})
+	slices.Sort(productIDs)
+	productIDs = slices.Compact(productIDs)
+
+	var order models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Locking in id order keeps concurrent checkouts from deadlocking
+		var products []models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", productIDs).Order("id").Find(&products).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]models.Product, len(products))
+		for _, product := range products {
+			byID[product.ID] = product
+		}
+		reserved, err := reservedQuantities(tx, productIDs)
+		if err != nil {
+			return err
+		}
+
+		var variants []models.ProductVariant
+		if err := tx.Where("product_id IN ?", productIDs).Find(&variants).Error; err != nil {
+			return err
+		}
+		variantsByID := make(map[uint]models.ProductVariant, len(variants))
+		soldByVariant := make(map[uint]bool)
+		for _, variant := range variants {
+			variantsByID[variant.ID] = variant
+			soldByVariant[variant.ProductID] = true
+		}
+		variantReserved := map[uint]int{}
+		if len(variantIDs) > 0 {
+			if variantReserved, err = reservedVariantQuantities(tx, variantIDs); err != nil {
+				return err
+			}
+		}
+
+		var unavailable []UnavailableItem
+		for _, key := range keys {
+			product, found := byID[key.productID]
+			item := UnavailableItem{ProductID: key.productID, VariantID: key.variant(), Requested: quantities[key]}
+			variant, variantFound := variantsByID[key.variantID]
+			switch {
+			case !found, key.variantID != 0 && (!variantFound || variant.ProductID != key.productID):
+				item.Reason = ReasonNotFound
+			case key.variantID == 0 && soldByVariant[key.productID]:
+				item.Reason = ReasonVariantRequired
+			case key.variantID != 0:
+				item.Available = variant.Stock - variantReserved[key.variantID]
+				if item.Available < item.Requested {
+					item.Reason = ReasonInsufficientStock
+				}
+			default:
+				item.Available = product.Stock - reserved[key.productID]
+				if item.Available < item.Requested {
+					item.Reason = ReasonInsufficientStock
+				}
+			}
+			if item.Reason != "" {
+				unavailable = append(unavailable, item)
+			}
+		}
+		if len(unavailable) > 0 {
+			return &UnavailableError{Items: unavailable}
+		}
+
+		// Variants carry their own price. The order takes the currency of
+		// its items, which must agree.
+		prices := make(map[checkoutKey]models.Money, len(keys))
+		for _, key := range keys {
+			prices[key] = byID[key.productID].Price
+			if key.variantID != 0 {
+				prices[key] = variantsByID[key.variantID].Price
+			}
+		}
+		total := prices[keys[0]].Zero()
+		lines := make([]models.ProductPerOrder, 0, len(keys))
+		for _, key := range keys {
+			quantity := quantities[key]
+			amount, err := lineTotal(quantity, prices[key], total.Zero())
+			if err != nil {
+				return err
+			}
+			if total, err = total.Add(amount); err != nil {
+				return err
+			}
+			lines = append(lines, models.ProductPerOrder{
+				ProductID: key.productID,
+				VariantID: key.variant(),
+				Quantity:  quantity,
+				UnitPrice: prices[key],
+				Discount:  total.Zero(),
+				LineTotal: amount,
+			})
+		}
+
+		order = models.Order{UserId: input.UserID, Status: models.OrderStatusPending, Total: total}
+		if err := tx.Omit(clause.Associations).Create(&order).Error; err != nil {
+			return err
+		}
+		for i := range lines {
+			lines[i].OrderID = order.ID
+		}
+		if err := tx.Omit(clause.Associations).Create(&lines).Error; err != nil {
+			return err
+		}
+		if err := s.reserve(tx, lines); err != nil {
+			return err
+		}
+
+		shipping := models.Shipping{OrderID: order.ID, Address: input.Address}
+		if err := tx.Create(&shipping).Error; err != nil {
+			return err
+		}
+		payment := models.Payment{OrderID: order.ID, Amount: order.Total, Type: input.PaymentType}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		if err := transition(tx, &order, models.OrderStatusPaid, input.Actor, "paid at checkout"); err != nil {
+			return err
+		}
+
+		return tx.Preload("ProductPerOrder").Preload("Shipping").Preload("Payment").
+			First(&order, order.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
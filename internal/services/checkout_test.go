@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"go_boilerplate/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns an in-memory database with the order and stock tables.
+// SQLite ignores row locks, so these tests cover the logic, not concurrency.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(
+		&models.Product{}, &models.ProductVariant{}, &models.Order{}, &models.OrderStatusHistory{},
+		&models.ProductPerOrder{}, &models.Payment{}, &models.Shipping{},
+		&models.StockReservation{}, &models.StockMovement{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// seedProduct creates a product priced at price minor units of MMK with
+// stock on hand
+func seedProduct(t *testing.T, db *gorm.DB, name string, price int64, stock int) models.Product {
+	t.Helper()
+	product := models.Product{
+		BrandID:    1,
+		CategoryID: 1,
+		Name:       name,
+		Price:      models.Money{Amount: price, Currency: "MMK"},
+		Stock:      stock,
+		UpdateBy:   "test",
+	}
+	if err := db.Omit(clause.Associations).Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func TestCheckout(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderService(db, time.Minute)
+	phone := seedProduct(t, db, "phone", 1250, 5)
+	cover := seedProduct(t, db, "cover", 300, 10)
+
+	order, err := orders.Checkout(CheckoutInput{
+		UserID: 1,
+		Items: []CheckoutItem{
+			{ProductID: phone.ID, Quantity: 2},
+			{ProductID: cover.ID, Quantity: 1},
+			{ProductID: phone.ID, Quantity: 1},
+		},
+		Address:     "Yangon",
+		PaymentType: "card",
+		Actor:       "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (models.Money{Amount: 3*1250 + 300, Currency: "MMK"}); !order.Total.Equal(want) {
+		t.Errorf("total = %s, want %s", order.Total, want)
+	}
+	if order.Status != models.OrderStatusPaid {
+		t.Errorf("status = %s, want %s", order.Status, models.OrderStatusPaid)
+	}
+	if !order.Payment.Amount.Equal(order.Total) || order.Shipping.Address != "Yangon" {
+		t.Errorf("payment %+v and shipping %+v do not match the order", order.Payment, order.Shipping)
+	}
+	if len(order.ProductPerOrder) != 2 {
+		t.Fatalf("got %d lines, want repeated items merged into 2", len(order.ProductPerOrder))
+	}
+	for _, line := range order.ProductPerOrder {
+		if line.ProductID == phone.ID && (line.Quantity != 3 || line.LineTotal.Amount != 3*1250) {
+			t.Errorf("phone line = %d for %s, want 3 for 37.50 MMK", line.Quantity, line.LineTotal)
+		}
+	}
+
+	// Paying at checkout turns the reservations into sales
+	level, err := orders.Stock(phone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level.OnHand != 2 || level.Reserved != 0 {
+		t.Errorf("phone stock = %+v, want 2 on hand and nothing reserved", level)
+	}
+}
+
+func TestCheckoutRejectsInvalidInput(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderService(db, time.Minute)
+	phone := seedProduct(t, db, "phone", 1250, 5)
+	items := []CheckoutItem{{ProductID: phone.ID, Quantity: 1}}
+
+	tests := []struct {
+		name  string
+		input CheckoutInput
+		err   error
+	}{
+		{"empty cart", CheckoutInput{UserID: 1, Address: "a", PaymentType: "card"}, ErrEmptyCart},
+		{"no address", CheckoutInput{UserID: 1, Items: items, Address: " ", PaymentType: "card"}, ErrAddressRequired},
+		{"no payment type", CheckoutInput{UserID: 1, Items: items, Address: "a"}, ErrPaymentTypeRequired},
+		{"zero quantity", CheckoutInput{UserID: 1, Items: []CheckoutItem{{ProductID: phone.ID}}, Address: "a", PaymentType: "card"}, ErrInvalidQuantity},
+	}
+	for _, tt := range tests {
+		if _, err := orders.Checkout(tt.input); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestCheckoutUnavailable(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderService(db, time.Minute)
+	phone := seedProduct(t, db, "phone", 1250, 2)
+	cover := seedProduct(t, db, "cover", 300, 10)
+
+	_, err := orders.Checkout(CheckoutInput{
+		UserID: 1,
+		Items: []CheckoutItem{
+			{ProductID: phone.ID, Quantity: 3},
+			{ProductID: cover.ID, Quantity: 1},
+			{ProductID: 99, Quantity: 1},
+		},
+		Address:     "Yangon",
+		PaymentType: "card",
+	})
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("error = %v, want an UnavailableError", err)
+	}
+	reasons := make(map[uint]string)
+	for _, item := range unavailable.Items {
+		reasons[item.ProductID] = item.Reason
+	}
+	if len(reasons) != 2 || reasons[phone.ID] != ReasonInsufficientStock || reasons[99] != ReasonNotFound {
+		t.Errorf("unavailable items = %+v, want the phone short of stock and product 99 missing", unavailable.Items)
+	}
+
+	// Nothing is written when any item is unavailable
+	for _, model := range []interface{}{&models.Order{}, &models.ProductPerOrder{}, &models.StockReservation{}, &models.Payment{}} {
+		var count int64
+		if err := db.Model(model).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%T: %d rows written, want none", model, count)
+		}
+	}
+}
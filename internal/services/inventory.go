@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidMovement    = errors.New("stock movement is invalid")
+	ErrStockBelowReserved = errors.New("stock on hand cannot drop below the reserved quantity")
+)
+
+// movementDirections gives the sign each kind's quantity must have:
+// 1 for additions, -1 for removals and 0 when either is allowed
+var movementDirections = map[string]int{
+	models.MovementReceipt:    1,
+	models.MovementReturn:     1,
+	models.MovementSale:       -1,
+	models.MovementRepairPart: -1,
+	models.MovementAdjustment: 0,
+	models.MovementTransfer:   0,
+}
+
+// StockDiscrepancy is a product or variant whose stock disagrees with its
+// ledger
+type StockDiscrepancy struct {
+	ProductID uint  `json:"productId"`
+	VariantID *uint `json:"variantId,omitempty"`
+	Stock     int   `json:"stock"`
+	Ledger    int   `json:"ledger"`
+}
+
+type InventoryService struct {
+	db *gorm.DB
+}
+
+func NewInventoryService(db *gorm.DB) *InventoryService {
+	return &InventoryService{
+		db: db,
+	}
+}
+
+// WithContext returns a copy of the service whose queries carry ctx
+func (s *InventoryService) WithContext(ctx context.Context) *InventoryService {
+	return &InventoryService{db: s.db.WithContext(ctx)}
+}
+
+// WithTx returns a copy of the service that works inside tx, so what it
+// records commits or rolls back with the caller's changes
+func (s *InventoryService) WithTx(tx *gorm.DB) *InventoryService {
+	return &InventoryService{db: tx}
+}
+
+func validateMovement(movement models.StockMovement) error {
+	direction, known := movementDirections[movement.Kind]
+	switch {
+	case !known:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidMovement, movement.Kind)
+	case movement.Quantity == 0:
+		return fmt.Errorf("%w: quantity must not be zero", ErrInvalidMovement)
+	case direction > 0 && movement.Quantity < 0:
+		return fmt.Errorf("%w: %s quantity must be positive", ErrInvalidMovement, movement.Kind)
+	case direction < 0 && movement.Quantity > 0:
+		return fmt.Errorf("%w: %s quantity must be negative", ErrInvalidMovement, movement.Kind)
+	}
+	return nil
+}
+
+// applyMovement appends the movement to the ledger and applies it to the
+// product's stock, and the variant's when it names one. It is the only place
+// stock on hand changes. Versions are bumped so edits made against the old
+// stock figure fail.
+func applyMovement(tx *gorm.DB, movement *models.StockMovement) error {
+	if err := tx.Create(movement).Error; err != nil {
+		return err
+	}
+	if movement.VariantID != nil {
+		if err := tx.Model(&models.ProductVariant{}).Where("id = ?", *movement.VariantID).Updates(map[string]interface{}{
+			"stock":   gorm.Expr("stock + ?", movement.Quantity),
+			"version": gorm.Expr("version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.Product{}).Where("id = ?", movement.ProductID).Updates(map[string]interface{}{
+		"stock":   gorm.Expr("stock + ?", movement.Quantity),
+		"version": gorm.Expr("version + 1"),
+	}).Error
+}
+
+// Record validates and applies a movement. Removals may not take the stock
+// on hand below what unpaid orders have reserved. Movements of products with
+// variants must name the variant.
+func (s *InventoryService) Record(movement models.StockMovement) (*models.StockMovement, error) {
+	if err := validateMovement(movement); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		available, err := lockStock(tx, movement.ProductID, movement.VariantID)
+		if err != nil {
+			return err
+		}
+		if available+movement.Quantity < 0 {
+			return fmt.Errorf("%w: %d available", ErrStockBelowReserved, available)
+		}
+		return applyMovement(tx, &movement)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+// SetStock records the adjustment that brings the stock on hand of the
+// product, or of its variant when variantID is set, to onHand. It returns
+// nil when the stock already matches.
+func (s *InventoryService) SetStock(productID uint, variantID *uint, onHand int, actor, reason string) (*models.StockMovement, error) {
+	var movement *models.StockMovement
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		available, err := lockStock(tx, productID, variantID)
+		if err != nil {
+			return err
+		}
+		var current int
+		if variantID != nil {
+			err = tx.Model(&models.ProductVariant{}).Where("id = ?", *variantID).Pluck("stock", &current).Error
+		} else {
+			err = tx.Model(&models.Product{}).Where("id = ?", productID).Pluck("stock", &current).Error
+		}
+		if err != nil {
+			return err
+		}
+		delta := onHand - current
+		if delta == 0 {
+			return nil
+		}
+		if available+delta < 0 {
+			return fmt.Errorf("%w: %d reserved", ErrStockBelowReserved, current-available)
+		}
+		movement = &models.StockMovement{
+			ProductID: productID,
+			VariantID: variantID,
+			Kind:      models.MovementAdjustment,
+			Quantity:  delta,
+			Reason:    reason,
+			Actor:     actor,
+		}
+		return applyMovement(tx, movement)
+	})
+	return movement, err
+}
+
+// Movements lists a product's ledger entries created in [from, to), oldest
+// first. Zero times leave that end of the range open.
+func (s *InventoryService) Movements(productID uint, from, to time.Time) ([]models.StockMovement, error) {
+	query := s.db.Where("product_id = ?", productID)
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at < ?", to)
+	}
+	var movements []models.StockMovement
+	err := query.Order("created_at, id").Find(&movements).Error
+	return movements, err
+}
+
+// Reconcile compares every product's and variant's stock with the sum of
+// its ledger. With apply set, mismatched stock is reset to the ledger,
+// which is the source of truth.
+func (s *InventoryService) Reconcile(apply bool) ([]StockDiscrepancy, error) {
+	var discrepancies []StockDiscrepancy
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&models.Product{}).
+			Select("products.id AS product_id, products.stock AS stock, COALESCE(SUM(stock_movements.quantity), 0) AS ledger").
+			Joins("LEFT JOIN stock_movements ON stock_movements.product_id = products.id").
+			Group("products.id, products.stock").
+			Having("products.stock <> COALESCE(SUM(stock_movements.quantity), 0)").
+			Order("products.id").
+			Scan(&discrepancies).Error
+		if err != nil {
+			return err
+		}
+		var variants []StockDiscrepancy
+		err = tx.Unscoped().Model(&models.ProductVariant{}).
+			Select("product_variants.product_id AS product_id, product_variants.id AS variant_id, product_variants.stock AS stock, COALESCE(SUM(stock_movements.quantity), 0) AS ledger").
+			Joins("LEFT JOIN stock_movements ON stock_movements.variant_id = product_variants.id").
+			Group("product_variants.id, product_variants.product_id, product_variants.stock").
+			Having("product_variants.stock <> COALESCE(SUM(stock_movements.quantity), 0)").
+			Order("product_variants.id").
+			Scan(&variants).Error
+		if err != nil {
+			return err
+		}
+		discrepancies = append(discrepancies, variants...)
+		if !apply {
+			return nil
+		}
+
+		for _, discrepancy := range discrepancies {
+			var model interface{} = &models.Product{}
+			id := discrepancy.ProductID
+			if discrepancy.VariantID != nil {
+				model, id = &models.ProductVariant{}, *discrepancy.VariantID
+			}
+			if err := tx.Unscoped().Model(model).Where("id = ?", id).
+				Updates(map[string]interface{}{
+					"stock":   discrepancy.Ledger,
+					"version": gorm.Expr("version + 1"),
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return discrepancies, nil
+}
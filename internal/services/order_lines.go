@@ -0,0 +1,287 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrProductNotFound   = errors.New("product not found")
+	ErrOrderLineNotFound = errors.New("order line not found")
+	ErrInvalidDiscount   = errors.New("discount must be between zero and the line subtotal")
+	ErrPaymentMismatch   = errors.New("payment amount does not match the order total")
+	ErrOrderNotPending   = errors.New("order is no longer pending")
+	ErrAlreadyPaid       = errors.New("order already has a payment")
+	ErrPaymentNotFound   = errors.New("payment not found")
+	ErrStalePayment      = errors.New("payment was changed")
+	ErrPaymentMoved      = errors.New("payment cannot move to another order")
+)
+
+// lineTotal prices a line, rejecting quantities below one and discounts
+// larger than the line itself. A zero discount may leave its currency out.
+func lineTotal(quantity int, unitPrice, discount models.Money) (models.Money, error) {
+	if quantity <= 0 {
+		return models.Money{}, ErrInvalidQuantity
+	}
+	subtotal := unitPrice.Mul(quantity)
+	if discount.IsZero() {
+		return subtotal, nil
+	}
+	total, err := subtotal.Sub(discount)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if discount.IsNegative() || total.IsNegative() {
+		return models.Money{}, ErrInvalidDiscount
+	}
+	return total, nil
+}
+
+// recalculateTotal sets the order total to the sum of its line totals.
+// Lines always share the order's currency.
+func recalculateTotal(tx *gorm.DB, orderID uint) error {
+	return tx.Model(&models.Order{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+		"total_minor": gorm.Expr("COALESCE((SELECT SUM(line_total_minor) FROM product_per_orders WHERE order_id = ?), 0)", orderID),
+		"version":     gorm.Expr("version + 1"),
+	}).Error
+}
+
+// lockOrder locks the order row for the rest of the transaction
+func lockOrder(tx *gorm.DB, orderID uint) (models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return order, ErrOrderNotFound
+	}
+	return order, err
+}
+
+// lockPendingOrder locks the order row and checks that the order is still
+// pending; only pending orders may change their lines or take a payment
+func lockPendingOrder(tx *gorm.DB, orderID uint) (models.Order, error) {
+	order, err := lockOrder(tx, orderID)
+	if err != nil {
+		return order, err
+	}
+	if order.Status != models.OrderStatusPending {
+		return order, fmt.Errorf("%w: order is %s", ErrOrderNotPending, order.Status)
+	}
+	return order, nil
+}
+
+// AddLine adds a product, or one of its variants, to an order at its
+// current price and updates the order total. A zero quantity means one.
+// Only pending orders take new lines, which reserve their stock like
+// checkout does.
+func (s *OrderService) AddLine(line models.ProductPerOrder) (*models.ProductPerOrder, error) {
+	if line.Quantity == 0 {
+		line.Quantity = 1
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPendingOrder(tx, line.OrderID)
+		if err != nil {
+			return err
+		}
+
+		var product models.Product
+		err = tx.First(&product, line.ProductID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return err
+		}
+		price, err := unitPrice(tx, product, line.VariantID)
+		if err != nil {
+			return err
+		}
+		if !price.SameCurrency(order.Total) {
+			return fmt.Errorf("%w: product is priced in %s, order is in %s",
+				models.ErrCurrencyMismatch, price.Currency, order.Total.Currency)
+		}
+		available, err := lockStock(tx, product.ID, line.VariantID)
+		if err != nil {
+			return err
+		}
+		if available < line.Quantity {
+			return fmt.Errorf("%w: %d requested, %d available", ErrInsufficientStock, line.Quantity, available)
+		}
+
+		line.UnitPrice = price
+		if line.Discount.IsZero() {
+			line.Discount = price.Zero()
+		}
+		if line.LineTotal, err = lineTotal(line.Quantity, line.UnitPrice, line.Discount); err != nil {
+			return err
+		}
+		if err := tx.Omit("Order", "Product", "Variant").Create(&line).Error; err != nil {
+			return err
+		}
+		if err := s.reserve(tx, []models.ProductPerOrder{line}); err != nil {
+			return err
+		}
+		return recalculateTotal(tx, line.OrderID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// RemoveLine deletes a pending order's line with its reservation and
+// updates the order total
+func (s *OrderService) RemoveLine(lineID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var line models.ProductPerOrder
+		err := tx.First(&line, lineID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrderLineNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := lockPendingOrder(tx, line.OrderID); err != nil {
+			return err
+		}
+		if err := tx.Where("product_per_order_id = ?", line.ID).Delete(&models.StockReservation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&line).Error; err != nil {
+			return err
+		}
+		return recalculateTotal(tx, line.OrderID)
+	})
+}
+
+// hasPayment reports whether a payment has been recorded for the order
+func hasPayment(tx *gorm.DB, orderID uint) (bool, error) {
+	var payments int64
+	err := tx.Model(&models.Payment{}).Where("order_id = ?", orderID).Count(&payments).Error
+	return payments > 0, err
+}
+
+// RecordPayment creates a payment for a pending order that has none yet and
+// marks the order paid, which converts its reserved stock. The amount must
+// settle the order's total exactly. Everything happens in one transaction
+// holding the order row, so an order is paid at most once.
+func (s *OrderService) RecordPayment(payment *models.Payment, actor string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPendingOrder(tx, payment.OrderID)
+		if err != nil {
+			return err
+		}
+		paid, err := hasPayment(tx, order.ID)
+		if err != nil {
+			return err
+		}
+		if paid {
+			return ErrAlreadyPaid
+		}
+		if !payment.Amount.Equal(order.Total) {
+			return fmt.Errorf("%w: amount %s, total %s", ErrPaymentMismatch, payment.Amount, order.Total)
+		}
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return transition(tx, &order, models.OrderStatusPaid, actor, "payment recorded")
+	})
+}
+
+// UpdatePayment changes the amount and type of a payment that is still at
+// version; a zero amount or empty type keeps the current one, and a non-zero
+// orderID must be the payment's own order. The order row and then the
+// payment row are locked, as RecordPayment locks the order before inserting,
+// so the version check and the new amount, which must still settle the
+// order's total exactly, hold until the update commits. It returns
+// ErrStalePayment when the payment is at another version.
+func (s *OrderService) UpdatePayment(paymentID, version, orderID uint, amount models.Money, paymentType string) (*models.Payment, error) {
+	var payment models.Payment
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// A payment never moves to another order, so its order can be
+		// looked up before taking the locks
+		var paymentOrderID uint
+		err := tx.Model(&models.Payment{}).Where("id = ?", paymentID).Pluck("order_id", &paymentOrderID).Error
+		if err != nil {
+			return err
+		}
+		if paymentOrderID == 0 {
+			return ErrPaymentNotFound
+		}
+		order, err := lockOrder(tx, paymentOrderID)
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPaymentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if payment.Version != version {
+			return ErrStalePayment
+		}
+		if orderID != 0 && orderID != payment.OrderID {
+			return ErrPaymentMoved
+		}
+
+		if amount != (models.Money{}) {
+			payment.Amount = amount
+		}
+		if paymentType != "" {
+			payment.Type = paymentType
+		}
+		if !payment.Amount.Equal(order.Total) {
+			return fmt.Errorf("%w: amount %s, total %s", ErrPaymentMismatch, payment.Amount, order.Total)
+		}
+
+		payment.Version++
+		return tx.Model(&payment).Updates(map[string]interface{}{
+			"amount_minor":    payment.Amount.Amount,
+			"amount_currency": payment.Amount.Currency,
+			"type":            payment.Type,
+			"version":         payment.Version,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// DeletePayment deletes a payment that is still at version. Paying an order
+// converted its reserved stock into sales, so only payments of orders that
+// are still pending may go; a paid order is refunded instead. The order row
+// is locked before the payment, as in UpdatePayment.
+func (s *OrderService) DeletePayment(paymentID, version uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var orderID uint
+		err := tx.Model(&models.Payment{}).Where("id = ?", paymentID).Pluck("order_id", &orderID).Error
+		if err != nil {
+			return err
+		}
+		if orderID == 0 {
+			return ErrPaymentNotFound
+		}
+		if _, err := lockPendingOrder(tx, orderID); err != nil {
+			return err
+		}
+		var payment models.Payment
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPaymentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if payment.Version != version {
+			return ErrStalePayment
+		}
+		return tx.Delete(&payment).Error
+	})
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderNotFound      = errors.New("order not found")
+	ErrInvalidOrderStatus = errors.New("order status is invalid")
+	ErrIllegalTransition  = errors.New("illegal order status transition")
+)
+
+// orderTransitions lists the statuses each status may move to. Unpaid
+// orders can be cancelled; once paid, backing out means a refund.
+// Cancelled and refunded are final.
+var orderTransitions = map[string][]string{
+	models.OrderStatusPending:   {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:      {models.OrderStatusPacked, models.OrderStatusRefunded},
+	models.OrderStatusPacked:    {models.OrderStatusShipped, models.OrderStatusRefunded},
+	models.OrderStatusShipped:   {models.OrderStatusDelivered},
+	models.OrderStatusDelivered: {models.OrderStatusRefunded},
+	models.OrderStatusCancelled: nil,
+	models.OrderStatusRefunded:  nil,
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	return slices.Contains(orderTransitions[from], to)
+}
+
+type OrderService struct {
+	db             *gorm.DB
+	reservationTTL time.Duration
+}
+
+// NewOrderService returns an order service whose stock reservations expire
+// after reservationTTL unless the order is paid
+func NewOrderService(db *gorm.DB, reservationTTL time.Duration) *OrderService {
+	return &OrderService{
+		db:             db,
+		reservationTTL: reservationTTL,
+	}
+}
+
+// WithContext returns a copy of the service whose queries carry ctx, so
+// changes it makes are attributed to the request's caller
+func (s *OrderService) WithContext(ctx context.Context) *OrderService {
+	clone := *s
+	clone.db = s.db.WithContext(ctx)
+	return &clone
+}
+
+// Transition moves the order to the given status and records who did it.
+// Paying converts the order's reserved stock into a stock decrement and
+// cancelling releases it. The order row is locked so concurrent transitions
+// are applied one at a time.
+func (s *OrderService) Transition(orderID uint, to, changedBy, note string) (*models.Order, error) {
+	if _, known := orderTransitions[to]; !known {
+		return nil, ErrInvalidOrderStatus
+	}
+
+	var order models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return transition(tx, &order, to, changedBy, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// transition moves an order the caller has locked, or just created, to the
+// given status within tx
+func transition(tx *gorm.DB, order *models.Order, to, changedBy, note string) error {
+	if !CanTransition(order.Status, to) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, order.Status, to)
+	}
+
+	history := models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   to,
+		ChangedBy:  changedBy,
+		Note:       note,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(order).Updates(map[string]interface{}{
+		"status":  to,
+		"version": gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	order.Status = to
+	order.Version++
+
+	switch to {
+	case models.OrderStatusPaid:
+		return convertReservations(tx, order.ID, changedBy)
+	case models.OrderStatusCancelled:
+		return releaseReservations(tx, order.ID)
+	}
+	return nil
+}
+
+// History returns the order's status transitions, oldest first
+func (s *OrderService) History(orderID uint) ([]models.OrderStatusHistory, error) {
+	var history []models.OrderStatusHistory
+	err := s.db.Where("order_id = ?", orderID).Order("created_at, id").Find(&history).Error
+	return history, err
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"go_boilerplate/internal/models"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.OrderStatusPending, models.OrderStatusPaid, true},
+		{models.OrderStatusPending, models.OrderStatusCancelled, true},
+		{models.OrderStatusPending, models.OrderStatusPacked, false},
+		{models.OrderStatusPending, models.OrderStatusRefunded, false},
+		{models.OrderStatusPaid, models.OrderStatusPacked, true},
+		{models.OrderStatusPaid, models.OrderStatusRefunded, true},
+		{models.OrderStatusPaid, models.OrderStatusCancelled, false},
+		{models.OrderStatusPaid, models.OrderStatusPending, false},
+		{models.OrderStatusPacked, models.OrderStatusShipped, true},
+		{models.OrderStatusPacked, models.OrderStatusRefunded, true},
+		{models.OrderStatusPacked, models.OrderStatusDelivered, false},
+		{models.OrderStatusShipped, models.OrderStatusDelivered, true},
+		{models.OrderStatusShipped, models.OrderStatusRefunded, false},
+		{models.OrderStatusDelivered, models.OrderStatusRefunded, true},
+		{models.OrderStatusDelivered, models.OrderStatusShipped, false},
+		{models.OrderStatusCancelled, models.OrderStatusPending, false},
+		{models.OrderStatusCancelled, models.OrderStatusPaid, false},
+		{models.OrderStatusRefunded, models.OrderStatusPaid, false},
+		{models.OrderStatusPending, models.OrderStatusPending, false},
+		{"unknown", models.OrderStatusPaid, false},
+		{models.OrderStatusPending, "unknown", false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestOrderTransitionsTargetKnownStatuses(t *testing.T) {
+	for from, targets := range orderTransitions {
+		for _, to := range targets {
+			if _, known := orderTransitions[to]; !known {
+				t.Errorf("%s may move to unknown status %q", from, to)
+			}
+		}
+	}
+	for _, final := range []string{models.OrderStatusCancelled, models.OrderStatusRefunded} {
+		if targets := orderTransitions[final]; len(targets) != 0 {
+			t.Errorf("%s is final but may move to %v", final, targets)
+		}
+	}
+}
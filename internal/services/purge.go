@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+	"go_boilerplate/pkg"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PurgeResult counts the rows removed by one purge run
+type PurgeResult struct {
+	Orders     int
+	Products   int
+	Variants   int
+	Brands     int
+	Categories int
+}
+
+// PurgeService permanently removes rows that were soft deleted longer ago
+// than the retention period
+type PurgeService struct {
+	db        *gorm.DB
+	storage   pkg.Storage
+	retention time.Duration
+}
+
+func NewPurgeService(db *gorm.DB, storage pkg.Storage, retention time.Duration) *PurgeService {
+	return &PurgeService{
+		db:        db,
+		storage:   storage,
+		retention: retention,
+	}
+}
+
+// Purge removes expired orders together with their lines, payments,
+// shipping, reservations and status history, then expired variants,
+// products, brands and categories. Products and variants still referenced
+// by an order line and brands or categories that still have products are
+// kept until those are gone. A purged product takes its variants with it.
+// Images of purged products and variants are deleted from storage once the
+// rows are removed.
+func (s *PurgeService) Purge(ctx context.Context) (PurgeResult, error) {
+	var result PurgeResult
+	var imageKeys, variantKeys []string
+	cutoff := time.Now().Add(-s.retention)
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orderIDs []uint
+		if err := tx.Unscoped().Model(&models.Order{}).
+			Where("deleted_at < ?", cutoff).Pluck("id", &orderIDs).Error; err != nil {
+			return err
+		}
+		if len(orderIDs) > 0 {
+			dependents := []interface{}{
+				&models.StockReservation{},
+				&models.ProductPerOrder{},
+				&models.Payment{},
+				&models.Shipping{},
+				&models.OrderStatusHistory{},
+			}
+			for _, dependent := range dependents {
+				if err := tx.Where("order_id IN ?", orderIDs).Delete(dependent).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Unscoped().Delete(&models.Order{}, orderIDs).Error; err != nil {
+				return err
+			}
+		}
+		result.Orders = len(orderIDs)
+
+		var variants []models.ProductVariant
+		if err := tx.Unscoped().
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM product_per_orders WHERE product_per_orders.variant_id = product_variants.id)").
+			Find(&variants).Error; err != nil {
+			return err
+		}
+		if len(variants) > 0 {
+			variantIDs := make([]uint, len(variants))
+			for i, variant := range variants {
+				variantIDs[i] = variant.ID
+				if variant.ImageKey != "" {
+					variantKeys = append(variantKeys, variant.ImageKey)
+				}
+			}
+			if err := tx.Unscoped().Delete(&models.ProductVariant{}, variantIDs).Error; err != nil {
+				return err
+			}
+		}
+		result.Variants = len(variants)
+
+		var products []models.Product
+		if err := tx.Unscoped().
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM product_per_orders WHERE product_per_orders.product_id = products.id)").
+			Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) > 0 {
+			productIDs := make([]uint, len(products))
+			for i, product := range products {
+				productIDs[i] = product.ID
+			}
+			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.ProductUpdateHistory{}).Error; err != nil {
+				return err
+			}
+			var images []models.ProductImage
+			if err := tx.Where("product_id IN ?", productIDs).Find(&images).Error; err != nil {
+				return err
+			}
+			for _, image := range images {
+				imageKeys = append(imageKeys, image.ObjectKeys()...)
+			}
+			if err := tx.Where("product_id IN ?", productIDs).Delete(&models.ProductImage{}).Error; err != nil {
+				return err
+			}
+			var productVariants []models.ProductVariant
+			if err := tx.Unscoped().Where("product_id IN ?", productIDs).Find(&productVariants).Error; err != nil {
+				return err
+			}
+			for _, variant := range productVariants {
+				if variant.ImageKey != "" {
+					variantKeys = append(variantKeys, variant.ImageKey)
+				}
+			}
+			if err := tx.Unscoped().Where("product_id IN ?", productIDs).Delete(&models.ProductVariant{}).Error; err != nil {
+				return err
+			}
+			result.Variants += len(productVariants)
+			if err := tx.Unscoped().Delete(&models.Product{}, productIDs).Error; err != nil {
+				return err
+			}
+		}
+		result.Products = len(products)
+
+		// Variants given the same file share its object, which stays while
+		// a remaining variant refers to it
+		if len(variantKeys) > 0 {
+			slices.Sort(variantKeys)
+			variantKeys = slices.Compact(variantKeys)
+			var inUse []string
+			if err := tx.Unscoped().Model(&models.ProductVariant{}).
+				Where("image_key IN ?", variantKeys).Pluck("image_key", &inUse).Error; err != nil {
+				return err
+			}
+			for _, key := range variantKeys {
+				if !slices.Contains(inUse, key) {
+					imageKeys = append(imageKeys, key)
+				}
+			}
+		}
+
+		// Soft deleted products still hold their foreign keys, so the
+		// existence checks deliberately look at every product row
+		brands := tx.Unscoped().
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM products WHERE products.brand_id = brands.id)").
+			Delete(&models.Brand{})
+		if brands.Error != nil {
+			return brands.Error
+		}
+		result.Brands = int(brands.RowsAffected)
+
+		categories := tx.Unscoped().
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM products WHERE products.category_id = categories.id)").
+			Delete(&models.Category{})
+		if categories.Error != nil {
+			return categories.Error
+		}
+		result.Categories = int(categories.RowsAffected)
+		return nil
+	})
+	if err != nil {
+		return PurgeResult{}, err
+	}
+
+	var errs []error
+	for _, key := range imageKeys {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("delete image %s: %w", key, err))
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// Run purges every interval until ctx is cancelled
+func (s *PurgeService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		result, err := s.Purge(ctx)
+		if err != nil {
+			fmt.Println("purge failed:", err)
+		} else {
+			fmt.Printf("Purged %d orders, %d products, %d variants, %d brands, %d categories\n",
+				result.Orders, result.Products, result.Variants, result.Brands, result.Categories)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInsufficientStock = errors.New("not enough stock available")
+
+// StockLevel splits a product's stock into what is physically on hand,
+// what is held for unpaid orders and what can still be sold. Products with
+// variants list the level of each variant as well.
+type StockLevel struct {
+	ProductID uint         `json:"productId"`
+	VariantID *uint        `json:"variantId,omitempty"`
+	OnHand    int          `json:"onHand"`
+	Reserved  int          `json:"reserved"`
+	Available int          `json:"available"`
+	Variants  []StockLevel `json:"variants,omitempty"`
+}
+
+// reservedQuantities returns the quantity held per product
+func reservedQuantities(tx *gorm.DB, productIDs []uint) (map[uint]int, error) {
+	var rows []struct {
+		ProductID uint
+		Reserved  int
+	}
+	err := tx.Model(&models.StockReservation{}).
+		Select("product_id, SUM(quantity) AS reserved").
+		Where("product_id IN ? AND status = ?", productIDs, models.ReservationHeld).
+		Group("product_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	reserved := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		reserved[row.ProductID] = row.Reserved
+	}
+	return reserved, nil
+}
+
+// reserve holds stock for each line until the reservation expires
+func (s *OrderService) reserve(tx *gorm.DB, lines []models.ProductPerOrder) error {
+	expiresAt := time.Now().Add(s.reservationTTL)
+	reservations := make([]models.StockReservation, len(lines))
+	for i, line := range lines {
+		reservations[i] = models.StockReservation{
+			ProductID:         line.ProductID,
+			VariantID:         line.VariantID,
+			OrderID:           line.OrderID,
+			ProductPerOrderID: line.ID,
+			Quantity:          line.Quantity,
+			Status:            models.ReservationHeld,
+			ExpiresAt:         expiresAt,
+		}
+	}
+	return tx.Create(&reservations).Error
+}
+
+// convertReservations turns the order's held stock into sale movements
+func convertReservations(tx *gorm.DB, orderID uint, actor string) error {
+	var reservations []models.StockReservation
+	if err := tx.Where("order_id = ? AND status = ?", orderID, models.ReservationHeld).
+		Find(&reservations).Error; err != nil {
+		return err
+	}
+	for _, reservation := range reservations {
+		movement := models.StockMovement{
+			ProductID: reservation.ProductID,
+			VariantID: reservation.VariantID,
+			Kind:      models.MovementSale,
+			Quantity:  -reservation.Quantity,
+			Reason:    fmt.Sprintf("order %d paid", orderID),
+			Actor:     actor,
+			OrderID:   &reservation.OrderID,
+		}
+		if err := applyMovement(tx, &movement); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.StockReservation{}).
+		Where("order_id = ? AND status = ?", orderID, models.ReservationHeld).
+		Update("status", models.ReservationConverted).Error
+}
+
+// releaseReservations returns the order's held stock to the available pool
+func releaseReservations(tx *gorm.DB, orderID uint) error {
+	return tx.Model(&models.StockReservation{}).
+		Where("order_id = ? AND status = ?", orderID, models.ReservationHeld).
+		Update("status", models.ReservationReleased).Error
+}
+
+// Stock reports the on hand, reserved and available quantities of a product
+func (s *OrderService) Stock(productID uint) (StockLevel, error) {
+	var product models.Product
+	err := s.db.Select("id", "stock").First(&product, productID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return StockLevel{}, ErrProductNotFound
+	}
+	if err != nil {
+		return StockLevel{}, err
+	}
+	reserved, err := reservedQuantities(s.db, []uint{productID})
+	if err != nil {
+		return StockLevel{}, err
+	}
+	level := StockLevel{
+		ProductID: productID,
+		OnHand:    product.Stock,
+		Reserved:  reserved[productID],
+		Available: product.Stock - reserved[productID],
+	}
+
+	var variants []models.ProductVariant
+	if err := s.db.Select("id", "stock").Where("product_id = ?", productID).Order("id").Find(&variants).Error; err != nil {
+		return StockLevel{}, err
+	}
+	if len(variants) == 0 {
+		return level, nil
+	}
+	variantIDs := make([]uint, len(variants))
+	for i, variant := range variants {
+		variantIDs[i] = variant.ID
+	}
+	variantReserved, err := reservedVariantQuantities(s.db, variantIDs)
+	if err != nil {
+		return StockLevel{}, err
+	}
+	for _, variant := range variants {
+		level.Variants = append(level.Variants, StockLevel{
+			ProductID: productID,
+			VariantID: &variant.ID,
+			OnHand:    variant.Stock,
+			Reserved:  variantReserved[variant.ID],
+			Available: variant.Stock - variantReserved[variant.ID],
+		})
+	}
+	return level, nil
+}
+
+// lockAvailable locks the product row and returns its available quantity.
+// Every writer of held reservations locks the product first, so the result
+// stays valid until the transaction ends.
+func lockAvailable(tx *gorm.DB, productID uint) (int, error) {
+	var product models.Product
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "stock").First(&product, productID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	reserved, err := reservedQuantities(tx, []uint{productID})
+	if err != nil {
+		return 0, err
+	}
+	return product.Stock - reserved[productID], nil
+}
+
+// ReleaseExpired cancels pending orders whose reservations have expired,
+// which releases their stock. Orders with a payment are left alone. It
+// returns how many orders were cancelled.
+func (s *OrderService) ReleaseExpired() (int, error) {
+	var orderIDs []uint
+	if err := s.db.Model(&models.StockReservation{}).
+		Where("status = ? AND expires_at < ?", models.ReservationHeld, time.Now()).
+		Where("order_id NOT IN (?)", s.db.Model(&models.Payment{}).Select("order_id")).
+		Distinct().Pluck("order_id", &orderIDs).Error; err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	var errs []error
+	for _, orderID := range orderIDs {
+		ok, err := s.cancelExpired(orderID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %d: %w", orderID, err))
+		} else if ok {
+			cancelled++
+		}
+	}
+	return cancelled, errors.Join(errs...)
+}
+
+// cancelExpired cancels one order whose reservations expired. The payment
+// check is repeated under the order lock so a payment recorded since the
+// order was picked keeps it.
+func (s *OrderService) cancelExpired(orderID uint) (bool, error) {
+	cancelled := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPendingOrder(tx, orderID)
+		if errors.Is(err, ErrOrderNotPending) || errors.Is(err, ErrOrderNotFound) {
+			// The order moved on without converting its stock; just let it go
+			return releaseReservations(tx, orderID)
+		}
+		if err != nil {
+			return err
+		}
+		paid, err := hasPayment(tx, orderID)
+		if err != nil || paid {
+			return err
+		}
+		cancelled = true
+		return transition(tx, &order, models.OrderStatusCancelled, "system", "stock reservation expired")
+	})
+	return cancelled && err == nil, err
+}
+
+// RunReservationSweeper releases expired reservations every interval until
+// ctx is cancelled
+func (s *OrderService) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cancelled, err := s.ReleaseExpired()
+		if err != nil {
+			fmt.Println("releasing expired reservations failed:", err)
+		}
+		if cancelled > 0 {
+			fmt.Printf("Cancelled %d orders with expired reservations\n", cancelled)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"errors"
+	"go_boilerplate/internal/models"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pendingOrder creates a pending order holding quantity of the product
+func pendingOrder(t *testing.T, db *gorm.DB, orders *OrderService, productID uint, quantity int) models.Order {
+	t.Helper()
+	order := models.Order{UserId: 1, Status: models.OrderStatusPending, Total: models.Money{Currency: "MMK"}}
+	if err := db.Omit(clause.Associations).Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.AddLine(models.ProductPerOrder{OrderID: order.ID, ProductID: productID, Quantity: quantity}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func orderStatus(t *testing.T, db *gorm.DB, orderID uint) string {
+	t.Helper()
+	var order models.Order
+	if err := db.Select("status").First(&order, orderID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order.Status
+}
+
+func TestReleaseExpired(t *testing.T) {
+	db := newTestDB(t)
+	expired := NewOrderService(db, -time.Minute)
+	phone := seedProduct(t, db, "phone", 1000, 10)
+
+	unpaid := pendingOrder(t, db, expired, phone.ID, 2)
+	settled := pendingOrder(t, db, expired, phone.ID, 3)
+	// A payment recorded outside RecordPayment still keeps the order
+	if err := db.Create(&models.Payment{OrderID: settled.ID, Amount: settled.Total, Type: "card"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	fresh := pendingOrder(t, db, NewOrderService(db, time.Hour), phone.ID, 4)
+
+	cancelled, err := expired.ReleaseExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled != 1 {
+		t.Errorf("cancelled %d orders, want 1", cancelled)
+	}
+
+	tests := []struct {
+		name    string
+		orderID uint
+		status  string
+	}{
+		{"expired and unpaid", unpaid.ID, models.OrderStatusCancelled},
+		{"expired with a payment", settled.ID, models.OrderStatusPending},
+		{"not expired", fresh.ID, models.OrderStatusPending},
+	}
+	for _, tt := range tests {
+		if status := orderStatus(t, db, tt.orderID); status != tt.status {
+			t.Errorf("%s: status = %s, want %s", tt.name, status, tt.status)
+		}
+	}
+
+	level, err := expired.Stock(phone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level.OnHand != 10 || level.Reserved != 3+4 {
+		t.Errorf("stock = %+v, want 10 on hand with the cancelled order's 2 released", level)
+	}
+}
+
+func TestRecordPayment(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderService(db, -time.Minute)
+	phone := seedProduct(t, db, "phone", 1000, 10)
+	order := pendingOrder(t, db, orders, phone.ID, 2)
+
+	short := models.Money{Amount: order.Total.Amount - 1, Currency: "MMK"}
+	if err := orders.RecordPayment(&models.Payment{OrderID: order.ID, Amount: short, Type: "card"}, "1"); !errors.Is(err, ErrPaymentMismatch) {
+		t.Errorf("short payment error = %v, want %v", err, ErrPaymentMismatch)
+	}
+	if err := orders.RecordPayment(&models.Payment{OrderID: 99, Amount: order.Total, Type: "card"}, "1"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("payment of a missing order error = %v, want %v", err, ErrOrderNotFound)
+	}
+
+	payment := models.Payment{OrderID: order.ID, Amount: order.Total, Type: "card"}
+	if err := orders.RecordPayment(&payment, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if status := orderStatus(t, db, order.ID); status != models.OrderStatusPaid {
+		t.Errorf("status = %s, want %s", status, models.OrderStatusPaid)
+	}
+	level, err := orders.Stock(phone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level.OnHand != 8 || level.Reserved != 0 {
+		t.Errorf("stock = %+v, want the reservation converted into a sale", level)
+	}
+
+	// Expired reservations of a paid order were converted, so the sweep
+	// leaves it alone
+	if cancelled, err := orders.ReleaseExpired(); err != nil || cancelled != 0 {
+		t.Errorf("ReleaseExpired = %d, %v, want nothing cancelled", cancelled, err)
+	}
+
+	if err := orders.RecordPayment(&models.Payment{OrderID: order.ID, Amount: order.Total, Type: "card"}, "1"); !errors.Is(err, ErrOrderNotPending) {
+		t.Errorf("second payment error = %v, want %v", err, ErrOrderNotPending)
+	}
+	if _, err := orders.AddLine(models.ProductPerOrder{OrderID: order.ID, ProductID: phone.ID}); !errors.Is(err, ErrOrderNotPending) {
+		t.Errorf("adding a line to a paid order error = %v, want %v", err, ErrOrderNotPending)
+	}
+}
+
+func TestRecordPaymentRejectsExistingPayment(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderService(db, time.Minute)
+	phone := seedProduct(t, db, "phone", 1000, 10)
+	order := pendingOrder(t, db, orders, phone.ID, 1)
+	if err := db.Create(&models.Payment{OrderID: order.ID, Amount: order.Total, Type: "card"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := orders.RecordPayment(&models.Payment{OrderID: order.ID, Amount: order.Total, Type: "card"}, "1")
+	if !errors.Is(err, ErrAlreadyPaid) {
+		t.Errorf("error = %v, want %v", err, ErrAlreadyPaid)
+	}
+}
+
+func TestUpdatePayment(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderService(db, time.Minute)
+	phone := seedProduct(t, db, "phone", 1000, 10)
+	order := pendingOrder(t, db, orders, phone.ID, 2)
+	payment := models.Payment{OrderID: order.ID, Amount: order.Total, Type: "card"}
+	if err := orders.RecordPayment(&payment, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	short := models.Money{Amount: order.Total.Amount - 1, Currency: "MMK"}
+	tests := []struct {
+		name      string
+		paymentID uint
+		version   uint
+		amount    models.Money
+		err       error
+	}{
+		{"amount short of the total", payment.ID, payment.Version, short, ErrPaymentMismatch},
+		{"stale version", payment.ID, payment.Version + 1, models.Money{}, ErrStalePayment},
+		{"stale version with a bad amount", payment.ID, payment.Version + 1, short, ErrStalePayment},
+		{"missing payment", 99, 1, models.Money{}, ErrPaymentNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := orders.UpdatePayment(tt.paymentID, tt.version, 0, tt.amount, "cash"); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	if _, err := orders.UpdatePayment(payment.ID, payment.Version, order.ID+1, models.Money{}, "cash"); !errors.Is(err, ErrPaymentMoved) {
+		t.Errorf("moving the payment error = %v, want %v", err, ErrPaymentMoved)
+	}
+	updated, err := orders.UpdatePayment(payment.ID, payment.Version, order.ID, models.Money{}, "cash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Payment
+	if err := db.First(&stored, payment.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Type != "cash" || !stored.Amount.Equal(order.Total) || stored.OrderID != order.ID {
+		t.Errorf("stored payment = %+v, want only the type changed", stored)
+	}
+	if updated.Version != payment.Version+1 || stored.Version != updated.Version {
+		t.Errorf("version = %d, stored %d, want %d", updated.Version, stored.Version, payment.Version+1)
+	}
+}
+
+func TestDeletePayment(t *testing.T) {
+	db := newTestDB(t)
+	orders := NewOrderService(db, time.Minute)
+	phone := seedProduct(t, db, "phone", 1000, 10)
+
+	paidOrder := pendingOrder(t, db, orders, phone.ID, 2)
+	settled := models.Payment{OrderID: paidOrder.ID, Amount: paidOrder.Total, Type: "card"}
+	if err := orders.RecordPayment(&settled, "1"); err != nil {
+		t.Fatal(err)
+	}
+	// A payment recorded outside RecordPayment leaves its order pending
+	pending := pendingOrder(t, db, orders, phone.ID, 1)
+	unsettled := models.Payment{OrderID: pending.ID, Amount: pending.Total, Type: "card"}
+	if err := db.Create(&unsettled).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		paymentID uint
+		version   uint
+		err       error
+	}{
+		{"payment of a paid order", settled.ID, settled.Version, ErrOrderNotPending},
+		{"stale version", unsettled.ID, unsettled.Version + 1, ErrStalePayment},
+		{"missing payment", 99, 1, ErrPaymentNotFound},
+		{"payment of a pending order", unsettled.ID, unsettled.Version, nil},
+	}
+	for _, tt := range tests {
+		if err := orders.DeletePayment(tt.paymentID, tt.version); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	var payments []models.Payment
+	if err := db.Find(&payments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || payments[0].ID != settled.ID {
+		t.Errorf("payments left = %+v, want only the paid order's", payments)
+	}
+	if status := orderStatus(t, db, paidOrder.ID); status != models.OrderStatusPaid {
+		t.Errorf("status = %s, want %s", status, models.OrderStatusPaid)
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+	"go_boilerplate/pkg"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrDirectUploadsUnsupported = errors.New("storage backend does not support direct uploads")
+	ErrUploadNotFound           = errors.New("upload not found")
+	ErrUploadExpired            = errors.New("upload has expired")
+	ErrUploadMissing            = errors.New("file has not been uploaded")
+)
+
+// StagingPrefix is where direct uploads land before they are completed.
+// Staging objects are not validated yet and are never served.
+const StagingPrefix = "pending/"
+
+// UploadService hands out presigned URLs for direct uploads and tracks the
+// uploads until they are completed or swept. Files go to a staging key of
+// their own; completing an upload copies what passes validation to its
+// target and removes the staging object.
+type UploadService struct {
+	db      *gorm.DB
+	storage pkg.Storage
+	ttl     time.Duration
+}
+
+func NewUploadService(db *gorm.DB, storage pkg.Storage, ttl time.Duration) *UploadService {
+	return &UploadService{
+		db:      db,
+		storage: storage,
+		ttl:     ttl,
+	}
+}
+
+// Begin records a pending upload and returns it with the URL the client
+// PUTs the file to. The URL is valid for the service's TTL and the upload
+// has twice that to be completed.
+func (s *UploadService) Begin(ctx context.Context, upload models.PendingUpload) (*models.PendingUpload, string, error) {
+	presigner, ok := s.storage.(pkg.Presigner)
+	if !ok {
+		return nil, "", ErrDirectUploadsUnsupported
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, "", err
+	}
+	upload.ObjectKey = StagingPrefix + hex.EncodeToString(token)
+	upload.ExpiresAt = time.Now().Add(2 * s.ttl)
+
+	url, err := presigner.PresignPut(upload.ObjectKey, upload.ContentType, upload.Size, s.ttl)
+	if err != nil {
+		return nil, "", fmt.Errorf("presigning upload: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Create(&upload).Error; err != nil {
+		return nil, "", err
+	}
+	return &upload, url, nil
+}
+
+// Claim loads an upload started by actor that can be completed: it has not
+// expired and its file is in storage
+func (s *UploadService) Claim(ctx context.Context, id uint, actor string) (*models.PendingUpload, error) {
+	var upload models.PendingUpload
+	err := s.db.WithContext(ctx).Where("created_by = ?", actor).First(&upload, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	exists, err := s.storage.Exists(ctx, upload.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUploadMissing
+	}
+	return &upload, nil
+}
+
+// Complete locks the pending upload and runs attach in the transaction that
+// removes it, so an upload is attached at most once: a concurrent completion
+// waits for the lock and then finds the upload gone before it has stored
+// anything. The staging object is deleted afterwards; failing to delete it
+// only leaves an orphan behind, the upload is still complete.
+func (s *UploadService) Complete(ctx context.Context, upload *models.PendingUpload, attach func(tx *gorm.DB) error) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked models.PendingUpload
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, upload.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUploadNotFound // Completed by a concurrent request
+		}
+		if err != nil {
+			return err
+		}
+		if err := attach(tx); err != nil {
+			return err
+		}
+		return tx.Delete(&locked).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.storage.Delete(ctx, upload.ObjectKey)
+	return nil
+}
+
+// Sweep removes expired uploads and whatever was uploaded for them
+func (s *UploadService) Sweep(ctx context.Context) (int, error) {
+	var uploads []models.PendingUpload
+	if err := s.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Find(&uploads).Error; err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	swept := 0
+	for _, upload := range uploads {
+		if err := s.storage.Delete(ctx, upload.ObjectKey); err != nil {
+			errs = append(errs, fmt.Errorf("delete upload %s: %w", upload.ObjectKey, err))
+			continue // Kept so the next sweep tries again
+		}
+		if err := s.db.WithContext(ctx).Delete(&upload).Error; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		swept++
+	}
+	return swept, errors.Join(errs...)
+}
+
+// RunSweeper sweeps expired uploads every interval until ctx is cancelled
+func (s *UploadService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		swept, err := s.Sweep(ctx)
+		if err != nil {
+			fmt.Println("sweeping expired uploads failed:", err)
+		}
+		if swept > 0 {
+			fmt.Printf("Swept %d expired uploads\n", swept)
+		}
+	}
+}
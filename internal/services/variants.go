@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVariantNotFound  = errors.New("product variant not found")
+	ErrVariantRequired  = errors.New("product is sold by variant, a variant is required")
+	ErrDuplicateSKU     = errors.New("SKU is already in use")
+	ErrUnallocatedStock = errors.New("product stock must be zero before its first variant is added")
+)
+
+// hasVariants reports whether the product has any live variants
+func hasVariants(tx *gorm.DB, productID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&count).Error
+	return count > 0, err
+}
+
+// findVariant loads a variant of the product
+func findVariant(tx *gorm.DB, productID, variantID uint) (models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := tx.Where("product_id = ?", productID).First(&variant, variantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return variant, ErrVariantNotFound
+	}
+	return variant, err
+}
+
+// unitPrice returns the price of one unit of the product, or of its variant
+// when variantID is set. Products with variants can only be sold by variant.
+func unitPrice(tx *gorm.DB, product models.Product, variantID *uint) (models.Money, error) {
+	if variantID == nil {
+		variants, err := hasVariants(tx, product.ID)
+		if err != nil {
+			return models.Money{}, err
+		}
+		if variants {
+			return models.Money{}, ErrVariantRequired
+		}
+		return product.Price, nil
+	}
+	variant, err := findVariant(tx, product.ID, *variantID)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return variant.Price, nil
+}
+
+// reservedVariantQuantities returns the quantity held per variant
+func reservedVariantQuantities(tx *gorm.DB, variantIDs []uint) (map[uint]int, error) {
+	var rows []struct {
+		VariantID uint
+		Reserved  int
+	}
+	err := tx.Model(&models.StockReservation{}).
+		Select("variant_id, SUM(quantity) AS reserved").
+		Where("variant_id IN ? AND status = ?", variantIDs, models.ReservationHeld).
+		Group("variant_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	reserved := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		reserved[row.VariantID] = row.Reserved
+	}
+	return reserved, nil
+}
+
+// lockStock locks the product and returns the quantity available for it,
+// or for one of its variants when variantID is set. Products with variants
+// only hold stock per variant.
+func lockStock(tx *gorm.DB, productID uint, variantID *uint) (int, error) {
+	available, err := lockAvailable(tx, productID)
+	if err != nil {
+		return 0, err
+	}
+	if variantID == nil {
+		variants, err := hasVariants(tx, productID)
+		if err != nil {
+			return 0, err
+		}
+		if variants {
+			return 0, ErrVariantRequired
+		}
+		return available, nil
+	}
+
+	variant, err := findVariant(tx, productID, *variantID)
+	if err != nil {
+		return 0, err
+	}
+	reserved, err := reservedVariantQuantities(tx, []uint{variant.ID})
+	if err != nil {
+		return 0, err
+	}
+	return variant.Stock - reserved[variant.ID], nil
+}
+
+// CreateVariant adds a variant to a product and books its initial stock
+// as a receipt. A product's stock moves to its variants, so the first
+// variant can only be added once the product's own stock is zero.
+func (s *InventoryService) CreateVariant(variant models.ProductVariant, stock int, actor string) (*models.ProductVariant, error) {
+	if stock < 0 {
+		return nil, fmt.Errorf("%w: initial stock must not be negative", ErrInvalidMovement)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockAvailable(tx, variant.ProductID); err != nil {
+			return err
+		}
+		var product models.Product
+		if err := tx.Select("id", "stock").First(&product, variant.ProductID).Error; err != nil {
+			return err
+		}
+		variants, err := hasVariants(tx, product.ID)
+		if err != nil {
+			return err
+		}
+		if !variants && product.Stock != 0 {
+			return fmt.Errorf("%w: %d on hand", ErrUnallocatedStock, product.Stock)
+		}
+
+		var taken int64
+		if err := tx.Unscoped().Model(&models.ProductVariant{}).
+			Where("sku = ?", variant.SKU).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return fmt.Errorf("%w: %s", ErrDuplicateSKU, variant.SKU)
+		}
+
+		variant.Stock = 0
+		if err := tx.Create(&variant).Error; err != nil {
+			return err
+		}
+		if stock == 0 {
+			return nil
+		}
+		movement := models.StockMovement{
+			ProductID: variant.ProductID,
+			VariantID: &variant.ID,
+			Kind:      models.MovementReceipt,
+			Quantity:  stock,
+			Reason:    "initial stock",
+			Actor:     actor,
+		}
+		if err := applyMovement(tx, &movement); err != nil {
+			return err
+		}
+		variant.Stock = stock
+		variant.Version++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
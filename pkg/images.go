@@ -0,0 +1,255 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Registers the WebP decoder
+)
+
+var (
+	ErrNotAnImage    = errors.New("file is not a JPEG, PNG, GIF or WebP image")
+	ErrImageTooLarge = errors.New("image is too large")
+)
+
+// imageFormats maps the sniffed content types that are accepted to the
+// extension their stored objects get
+var imageFormats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".png", // Stored as its first frame
+	"image/webp": ".webp",
+}
+
+// AcceptsImageType reports whether uploads of contentType are accepted
+func AcceptsImageType(contentType string) bool {
+	_, ok := imageFormats[contentType]
+	return ok
+}
+
+// ImageLimits bounds what an upload may be before it is decoded
+type ImageLimits struct {
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+}
+
+// RenditionSpec names a scaled copy of an upload and the width it is
+// scaled down to. Images narrower than Width keep their own size.
+type RenditionSpec struct {
+	Name  string
+	Width int
+}
+
+// EncodedImage is one stored form of an upload
+type EncodedImage struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+// ProcessedImage is an upload that passed validation. The original is
+// re-encoded, which drops EXIF and any other metadata, and each rendition
+// is encoded as WebP.
+type ProcessedImage struct {
+	Original   EncodedImage
+	Renditions map[string]EncodedImage
+}
+
+// ProcessImage reads an upload, checks that it really is an image within
+// limits and prepares the original and its renditions for storage. The
+// content type comes from the bytes, never from the file name.
+func ProcessImage(body io.Reader, limits ImageLimits, renditions []RenditionSpec) (*ProcessedImage, error) {
+	data, err := io.ReadAll(io.LimitReader(body, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrImageTooLarge, limits.MaxBytes)
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := imageFormats[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: detected %s", ErrNotAnImage, contentType)
+	}
+
+	// The header is enough to refuse oversized images before decoding them
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+	if config.Width > limits.MaxWidth || config.Height > limits.MaxHeight {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %dx%d", ErrImageTooLarge,
+			config.Width, config.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+	if contentType == "image/jpeg" {
+		// The orientation lives in the EXIF data that is about to be dropped
+		img = orient(img, jpegOrientation(data))
+	}
+
+	original, err := encode(img, extension)
+	if err != nil {
+		return nil, err
+	}
+	processed := &ProcessedImage{Original: original, Renditions: make(map[string]EncodedImage, len(renditions))}
+	for _, spec := range renditions {
+		rendition, err := encode(scaleToWidth(img, spec.Width), ".webp")
+		if err != nil {
+			return nil, err
+		}
+		processed.Renditions[spec.Name] = rendition
+	}
+	return processed, nil
+}
+
+func encode(img image.Image, extension string) (EncodedImage, error) {
+	var buf bytes.Buffer
+	var err error
+	switch extension {
+	case ".jpg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case ".png":
+		err = png.Encode(&buf, img)
+	case ".webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("no encoder for %s", extension)
+	}
+	if err != nil {
+		return EncodedImage{}, fmt.Errorf("encoding image: %w", err)
+	}
+	bounds := img.Bounds()
+	return EncodedImage{
+		Data:        buf.Bytes(),
+		ContentType: ContentTypeFor(extension),
+		Extension:   extension,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+	}, nil
+}
+
+// scaleToWidth shrinks img to width, keeping its aspect ratio. Images that
+// are already narrow enough are returned as they are.
+func scaleToWidth(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, 1 when it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return 1
+		}
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			return 1 // Image data starts, or the segment is broken
+		}
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient turns img upright according to an EXIF orientation
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	transposed := orientation >= 5
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	if transposed {
+		out = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Transposed
+				dx, dy = y, x
+			case 6: // Rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // Transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 90 counter clockwise
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package pkg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSignature = errors.New("upload URL is invalid, expired or does not match the request")
+
+// LocalStorage keeps objects on the local filesystem under Root, for
+// development without AWS. Files are served by the API under PublicURL,
+// which also accepts the uploads presigned by PresignPut. Those URLs are
+// signed with a key made at startup and do not survive a restart.
+type LocalStorage struct {
+	Root       string
+	PublicURL  string
+	signingKey []byte
+}
+
+func NewLocalStorage(root, publicURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("creating storage directory: %w", err)
+	}
+	signingKey := make([]byte, 32)
+	if _, err := rand.Read(signingKey); err != nil {
+		return nil, fmt.Errorf("creating upload signing key: %w", err)
+	}
+	return &LocalStorage{
+		Root:       root,
+		PublicURL:  strings.TrimRight(publicURL, "/"),
+		signingKey: signingKey,
+	}, nil
+}
+
+// path resolves key inside Root, rejecting keys that would escape it
+func (local *LocalStorage) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(local.Root, filepath.FromSlash(key)), nil
+}
+
+func (local *LocalStorage) Put(ctx context.Context, key string, body io.ReadSeeker, contentType string) error {
+	return local.write(key, body)
+}
+
+// write copies body to a temporary file and renames it into place so
+// readers never observe a partial object
+func (local *LocalStorage) write(key string, body io.Reader) error {
+	target, err := local.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// PresignPut returns the object's URL with the upload's constraints and an
+// HMAC over them in the query
+func (local *LocalStorage) PresignPut(key, contentType string, size int64, expires time.Duration) (string, error) {
+	if _, err := local.path(key); err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("content_type", contentType)
+	query.Set("size", strconv.FormatInt(size, 10))
+	query.Set("expires", strconv.FormatInt(time.Now().Add(expires).Unix(), 10))
+	query.Set("signature", local.sign(key, query))
+	return local.URL(key) + "?" + query.Encode(), nil
+}
+
+// PutSigned stores body under key for a request to a URL made by
+// PresignPut. The request's content type and length must be the signed
+// ones.
+func (local *LocalStorage) PutSigned(key string, query url.Values, contentType string, size int64, body io.Reader) error {
+	if !hmac.Equal([]byte(local.sign(key, query)), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidSignature
+	}
+	if contentType != query.Get("content_type") || strconv.FormatInt(size, 10) != query.Get("size") {
+		return ErrInvalidSignature
+	}
+	return local.write(key, io.LimitReader(body, size))
+}
+
+func (local *LocalStorage) sign(key string, query url.Values) string {
+	mac := hmac.New(sha256.New, local.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", key, query.Get("content_type"), query.Get("size"), query.Get("expires"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delete removes the object; deleting a missing key is not an error
+func (local *LocalStorage) Delete(ctx context.Context, key string) error {
+	target, err := local.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (local *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := local.path(key)
+	if err != nil {
+		// A key that cannot exist in the store is reported as missing
+		return nil, ErrObjectNotFound
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return file, err
+}
+
+func (local *LocalStorage) URL(key string) string {
+	return local.PublicURL + "/" + key
+}
+
+func (local *LocalStorage) Exists(ctx context.Context, key string) (bool, error) {
+	target, err := local.path(key)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.Mode().IsRegular(), nil
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go_boilerplate/internal/config"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// maxFileNameLength bounds the sanitized names kept for uploads, in runes
+const maxFileNameLength = 128
+
+// Storage stores uploaded files by key. The database keeps only the key;
+// URL turns it into something a client can fetch.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker, contentType string) error
+	Delete(ctx context.Context, key string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	URL(key string) string
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// Presigner is implemented by backends that let clients upload straight
+// to storage. PresignPut returns a URL that accepts one PUT of exactly size
+// bytes of contentType under key until it expires.
+type Presigner interface {
+	PresignPut(key, contentType string, size int64, expires time.Duration) (string, error)
+}
+
+// NewStorage returns the backend selected by the configuration
+func NewStorage(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage.Backend {
+	case "s3":
+		return NewS3Config(cfg.S3)
+	case "local":
+		return NewLocalStorage(cfg.Storage.LocalRoot, cfg.Storage.PublicURL)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+}
+
+// ContentKey builds the object key of data under prefix from its SHA-256
+// hash. Identical uploads share one object and different ones never
+// collide, whatever the client called the file.
+func ContentKey(prefix string, data []byte, extension string) string {
+	sum := sha256.Sum256(data)
+	return path.Join(prefix, hex.EncodeToString(sum[:])) + extension
+}
+
+// SanitizeFileName reduces a client supplied file name to its last path
+// element, keeping letters, digits, spaces and ".-_" and replacing anything
+// else with "_". Long names are cut from the front so the extension
+// survives. The result is only ever stored and shown, never used as a key.
+func SanitizeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "/" {
+		return ""
+	}
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r), strings.ContainsRune(" .-_", r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	name = strings.Trim(b.String(), " .")
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = strings.TrimLeft(string(runes[len(runes)-maxFileNameLength:]), " .")
+	}
+	return name
+}
+
+// ContentTypeFor guesses the content type from the key's extension
+func ContentTypeFor(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".pdf":
+		return "application/pdf"
+	}
+	return "application/octet-stream"
+}
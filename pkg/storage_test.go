@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	long := strings.Repeat("a", 200) + ".png"
+	tests := []struct {
+		name, want string
+	}{
+		{"photo.png", "photo.png"},
+		{"my photo (1).jpg", "my photo _1_.jpg"},
+		{"résumé.pdf", "résumé.pdf"},
+		{"e\u0301te\u0301.png", "e\u0301te\u0301.png"},
+		{"../../etc/passwd", "passwd"},
+		{"..", ""},
+		{".", ""},
+		{"/", ""},
+		{"", ""},
+		{"uploads/", "uploads"},
+		{"..\\..\\windows\\evil.png", "evil.png"},
+		{"C:\\Users\\me\\Desktop\\cat.gif", "cat.gif"},
+		{"dir\\..\\cat.gif", "cat.gif"},
+		{"  .hidden.  ", "hidden"},
+		{"...png", "png"},
+		{"name\x00.png", "name_.png"},
+		{"<script>alert(1)</script>.png", "script_.png"},
+		{"<b>bold</b>.png", "b_.png"},
+		{"a:b*c?d\"e|f.png", "a_b_c_d_e_f.png"},
+		{"tab\tand\nnewline.png", "tab_and_newline.png"},
+		{long, long[len(long)-maxFileNameLength:]},
+	}
+	for _, tt := range tests {
+		if got := SanitizeFileName(tt.name); got != tt.want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeFileNameLength(t *testing.T) {
+	tests := []struct {
+		name, suffix string
+	}{
+		// Cut by runes, never inside a multi-byte character
+		{strings.Repeat("ä", 300) + ".webp", ".webp"},
+		// A cut that starts at a dot or space is trimmed again
+		{strings.Repeat("a", 10) + ". " + strings.Repeat("b", 126) + ".jpg", ".jpg"},
+	}
+	for _, tt := range tests {
+		got := SanitizeFileName(tt.name)
+		if n := utf8.RuneCountInString(got); n > maxFileNameLength {
+			t.Errorf("SanitizeFileName kept %d runes, want at most %d", n, maxFileNameLength)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("SanitizeFileName(%q) = %q is not valid UTF-8", tt.name, got)
+		}
+		if !strings.HasSuffix(got, tt.suffix) {
+			t.Errorf("SanitizeFileName(%q) = %q lost its extension", tt.name, got)
+		}
+		if strings.HasPrefix(got, ".") || strings.HasPrefix(got, " ") {
+			t.Errorf("SanitizeFileName(%q) = %q starts with a dot or space", tt.name, got)
+		}
+	}
+}
+
+func TestContentKey(t *testing.T) {
+	// SHA-256 of "hello"
+	const sum = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	tests := []struct {
+		prefix, extension, want string
+	}{
+		{"products/1", ".png", "products/1/" + sum + ".png"},
+		{"products/1/", ".webp", "products/1/" + sum + ".webp"},
+		{"repairs/7", "", "repairs/7/" + sum},
+		{"", ".jpg", sum + ".jpg"},
+	}
+	for _, tt := range tests {
+		if got := ContentKey(tt.prefix, []byte("hello"), tt.extension); got != tt.want {
+			t.Errorf("ContentKey(%q, hello, %q) = %q, want %q", tt.prefix, tt.extension, got, tt.want)
+		}
+	}
+
+	if ContentKey("products/1", []byte("a"), ".png") == ContentKey("products/1", []byte("b"), ".png") {
+		t.Error("different content must get different keys")
+	}
+	if ContentKey("products/1", []byte("a"), ".png") == ContentKey("products/2", []byte("a"), ".png") {
+		t.Error("the same content under different prefixes must get different keys")
+	}
+}
@@ -0,0 +1,12 @@
+#!/bin/sh
+# Fails when go.mod or go.sum differ from what `go mod tidy` would write.
+# Run it before committing dependency changes; extra arguments are passed
+# to go mod tidy (e.g. -e when the module proxy is unreachable).
+set -eu
+
+cd "$(dirname "$0")/.."
+
+if ! go mod tidy -diff "$@"; then
+	echo "go.mod or go.sum is not tidy; run go mod tidy and commit the result" >&2
+	exit 1
+fi